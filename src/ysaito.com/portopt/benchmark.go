@@ -0,0 +1,113 @@
+package portopt
+
+// Statistics of the simple per-period returns of a security or portfolio
+// relative to those of a benchmark, e.g., "^GSPC", over the periods in
+// which both have prices.
+type BenchmarkStats struct {
+	Benchmark string
+
+	// Slope of the regression of the returns on the benchmark returns.
+	Beta float64
+
+	// Jensen's alpha: the mean per-period excess return (over the
+	// risk-free rate) beyond what Beta predicts from the mean excess
+	// return of the benchmark.
+	Alpha float64
+
+	// Fraction of the variance of the returns explained by the benchmark.
+	RSquared float64
+
+	// Standard deviation of the active returns, i.e., the returns minus
+	// the benchmark returns.
+	TrackingError float64
+
+	// Mean active return over TrackingError. Zero if TrackingError is
+	// zero.
+	InformationRatio float64
+
+	// Mean return over the mean benchmark return, in the periods in which
+	// the benchmark rose and fell, respectively. Zero if there were no
+	// such periods.
+	UpCapture float64
+	DownCapture float64
+}
+
+// Compute BenchmarkStats from aligned returns and risk-free returns.
+func benchmarkStats(benchmark string, returns []float64, benchReturns []float64, riskFree []float64) BenchmarkStats {
+	doAssert(len(returns) == len(benchReturns) && len(returns) == len(riskFree),
+		len(returns), " ", len(benchReturns), " ", len(riskFree))
+	stats := BenchmarkStats{Benchmark: benchmark}
+	n := float64(len(returns))
+	if n == 0 {
+		return stats
+	}
+	mean, meanB := 0.0, 0.0
+	active := make([]float64, len(returns))
+	var up, upB, down, downB float64
+	for k, r := range returns {
+		rb := benchReturns[k]
+		mean += r
+		meanB += rb
+		active[k] = r - rb
+		if rb > 0 {
+			up += r
+			upB += rb
+		} else if rb < 0 {
+			down += r
+			downB += rb
+		}
+	}
+	mean /= n
+	meanB /= n
+
+	cov, varB, varR := 0.0, 0.0, 0.0
+	for k, r := range returns {
+		cov += (r - mean) * (benchReturns[k] - meanB)
+		varB += (benchReturns[k] - meanB) * (benchReturns[k] - meanB)
+		varR += (r - mean) * (r - mean)
+	}
+	if varB > 0 {
+		stats.Beta = cov / varB
+		if varR > 0 {
+			stats.RSquared = cov * cov / varB / varR
+		}
+	}
+	meanRiskFree := 0.0
+	for _, rf := range riskFree {
+		meanRiskFree += rf
+	}
+	meanRiskFree /= n
+	stats.Alpha = mean - meanRiskFree - stats.Beta * (meanB - meanRiskFree)
+
+	meanActive, trackingError, _, _ := moments(active)
+	stats.TrackingError = trackingError
+	if trackingError > 0 {
+		stats.InformationRatio = meanActive / trackingError
+	}
+	if upB != 0 { stats.UpCapture = up / upB }
+	if downB != 0 { stats.DownCapture = down / downB }
+	return stats
+}
+
+// Statistics of the ticker relative to the benchmark over the periods of r
+// in which both have prices.
+func (db *Database) BenchmarkStats(ticker string, benchmark string, r *dateRange) (BenchmarkStats, error) {
+	js, err := db.jointStats([]string{ticker, benchmark}, r)
+	if err != nil { return BenchmarkStats{}, err }
+	riskFree, err := db.riskFreeReturns(js.dates)
+	if err != nil { return BenchmarkStats{}, err }
+	return benchmarkStats(benchmark, periodReturns(js.prices[0]), periodReturns(js.prices[1]), riskFree), nil
+}
+
+// Statistics of the portfolio, rebalanced to its weights every sampling
+// period, relative to the benchmark over the portfolio's date range.
+func (p *Portfolio) BenchmarkStats(benchmark string) (BenchmarkStats, error) {
+	tickers, weights := p.normalizedWeights()
+	js, err := p.Db().jointStats(append(tickers, benchmark), p.DateRange())
+	if err != nil { return BenchmarkStats{}, err }
+	riskFree, err := p.Db().riskFreeReturns(js.dates)
+	if err != nil { return BenchmarkStats{}, err }
+	return benchmarkStats(benchmark,
+		periodReturns(rebalancedValues(js, weights)),
+		periodReturns(js.prices[len(tickers)]), riskFree), nil
+}
@@ -0,0 +1,48 @@
+package portopt
+
+import "math"
+import "testing"
+
+func TestBenchmarkStats(t *testing.T) {
+	bench := []float64{0.02, -0.01, 0.03, -0.04, 0.01}
+	returns := make([]float64, len(bench))
+	for k, rb := range bench {
+		returns[k] = 0.001 + 2 * rb
+	}
+	riskFree := make([]float64, len(bench))
+	s := benchmarkStats("B", returns, bench, riskFree)
+	if s.Benchmark != "B" || math.Abs(s.Beta - 2) > 1e-12 || math.Abs(s.Alpha - 0.001) > 1e-12 { t.Error(s) }
+	if math.Abs(s.RSquared - 1) > 1e-12 { t.Error(s) }
+	// Up: (0.041 + 0.061 + 0.021) / 0.06. Down: (-0.019 - 0.079) / -0.05.
+	if math.Abs(s.UpCapture - 0.123 / 0.06) > 1e-12 || math.Abs(s.DownCapture - 0.098 / 0.05) > 1e-12 { t.Error(s) }
+	_, sd, _, _ := moments(bench)
+	if math.Abs(s.TrackingError - sd) > 1e-12 { t.Error(s, sd) }
+	if math.Abs(s.InformationRatio - (0.001 + 0.002) / sd) > 1e-12 { t.Error(s) }
+
+	// With a constant risk-free return of 0.002, the mean excess returns
+	// are 0.003 and 0.
+	for k := range riskFree {
+		riskFree[k] = 0.002
+	}
+	s = benchmarkStats("B", returns, bench, riskFree)
+	if math.Abs(s.Alpha - 0.003) > 1e-12 { t.Error(s) }
+}
+
+func TestBenchmarkStats_Database(t *testing.T) {
+	// The returns of TestBenchmarkStats, through the price table.
+	bench := []float64{0.02, -0.01, 0.03, -0.04, 0.01}
+	returns := make([]float64, len(bench))
+	for k, rb := range bench {
+		returns[k] = 0.001 + 2 * rb
+	}
+	f := newStatsFixture(t, "A", map[string][]float64{"A": compound(returns...), "B": compound(bench...)})
+
+	s, err := f.db.BenchmarkStats("A", "B", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(s.Beta - 2) > 1e-12 || math.Abs(s.Alpha - 0.001) > 1e-12 || math.Abs(s.RSquared - 1) > 1e-12 { t.Error(s) }
+	if math.Abs(s.UpCapture - 0.123 / 0.06) > 1e-12 || math.Abs(s.DownCapture - 0.098 / 0.05) > 1e-12 { t.Error(s) }
+
+	ps, err := f.portfolio.BenchmarkStats("B")
+	if err != nil { t.Fatal(err) }
+	if math.Abs(ps.Beta - 2) > 1e-12 || math.Abs(ps.TrackingError - s.TrackingError) > 1e-12 { t.Error(ps) }
+}
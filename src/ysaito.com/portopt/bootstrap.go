@@ -0,0 +1,255 @@
+package portopt
+
+import "fmt"
+import "math"
+import "math/rand"
+import "sort"
+
+// Controls the block bootstrap. Zero or nil fields take the values in
+// DefaultBootstrapOptions.
+type BootstrapOptions struct {
+	// Number of resampled series.
+	Samples int
+
+	// Number of consecutive periods drawn at a time, so that the
+	// resampled series keep the short-term dependence of the returns.
+	// Zero picks the cube root of the number of periods.
+	BlockLength int
+
+	// Coverage of the intervals, in (0, 1), e.g., 0.95.
+	Confidence float64
+
+	// Seed of the random number generator, so that results are
+	// reproducible. A pointer so that any seed, including 0, can be
+	// requested.
+	Seed *int64
+}
+
+var defaultBootstrapSeed int64 = 1
+
+var DefaultBootstrapOptions = BootstrapOptions{Samples: 1000, Confidence: 0.95, Seed: &defaultBootstrapSeed}
+
+// Fill in the defaults for a bootstrap of the given number of periods.
+func (o BootstrapOptions) withDefaults(periods int) (BootstrapOptions, error) {
+	if o.Confidence == 0 {
+		o.Confidence = DefaultBootstrapOptions.Confidence
+	} else if !(o.Confidence > 0 && o.Confidence < 1) {
+		return o, fmt.Errorf("Bad bootstrap confidence %v, want one in (0, 1)", o.Confidence)
+	}
+	if o.Samples <= 0 { o.Samples = DefaultBootstrapOptions.Samples }
+	if o.Seed == nil { o.Seed = DefaultBootstrapOptions.Seed }
+	if o.BlockLength <= 0 { o.BlockLength = int(math.Ceil(math.Cbrt(float64(periods)))) }
+	if o.BlockLength > periods { o.BlockLength = periods }
+	return o, nil
+}
+
+// A statistic computed from the data, and the percentile bootstrap
+// interval around it.
+type ConfidenceInterval struct {
+	Estimate float64
+	Low float64
+	High float64
+}
+
+// Confidence intervals for statistics of the simple per-period returns.
+type BootstrapStats struct {
+	Confidence float64
+	Mean ConfidenceInterval
+	Volatility ConfidenceInterval
+	Sharpe ConfidenceInterval  // see ExcessReturns
+}
+
+// Indexes of a circular block bootstrap sample of n periods: blocks of
+// blockLength consecutive periods starting at random, wrapping around at
+// the end.
+func blockBootstrapIndexes(rng *rand.Rand, n int, blockLength int) []int {
+	indexes := make([]int, 0, n)
+	for len(indexes) < n {
+		start := rng.Intn(n)
+		for j := 0; j < blockLength && len(indexes) < n; j++ {
+			indexes = append(indexes, (start + j) % n)
+		}
+	}
+	return indexes
+}
+
+// The interval between the (1-confidence)/2 and (1+confidence)/2 quantiles
+// of samples. Sorts samples.
+func percentileInterval(estimate float64, samples []float64, confidence float64) ConfidenceInterval {
+	sort.Float64s(samples)
+	last := float64(len(samples) - 1)
+	return ConfidenceInterval{
+		Estimate: estimate,
+		Low: samples[int(math.Floor((1 - confidence) / 2 * last))],
+		High: samples[int(math.Ceil((1 + confidence) / 2 * last))],
+	}
+}
+
+// Bootstrap the mean, volatility and Sharpe ratio of returns. riskFree is
+// resampled along with returns.
+func bootstrapReturns(returns []float64, riskFree []float64, opts BootstrapOptions) (*BootstrapStats, error) {
+	n := len(returns)
+	opts, err := opts.withDefaults(n)
+	if err != nil { return nil, err }
+	rng := rand.New(rand.NewSource(*opts.Seed))
+	means := make([]float64, opts.Samples)
+	vols := make([]float64, opts.Samples)
+	sharpes := make([]float64, opts.Samples)
+	sample := make([]float64, n)
+	sampleRiskFree := make([]float64, n)
+	for i := 0; i < opts.Samples; i++ {
+		for k, index := range blockBootstrapIndexes(rng, n, opts.BlockLength) {
+			sample[k] = returns[index]
+			sampleRiskFree[k] = riskFree[index]
+		}
+		means[i], vols[i], _, _ = moments(sample)
+		sharpes[i] = excessReturns(sample, sampleRiskFree).Sharpe
+	}
+	mean, vol, _, _ := moments(returns)
+	return &BootstrapStats{
+		Confidence: opts.Confidence,
+		Mean: percentileInterval(mean, means, opts.Confidence),
+		Volatility: percentileInterval(vol, vols, opts.Confidence),
+		Sharpe: percentileInterval(excessReturns(returns, riskFree).Sharpe, sharpes, opts.Confidence),
+	}, nil
+}
+
+// Pearson correlation of two equally long series.
+func pearson(x []float64, y []float64) float64 {
+	mx, sx, _, _ := moments(x)
+	my, sy, _, _ := moments(y)
+	if sx == 0 || sy == 0 {
+		return 0
+	}
+	total := 0.0
+	for k := range x {
+		total += (x[k] - mx) * (y[k] - my)
+	}
+	return total / float64(len(x)) / sx / sy
+}
+
+// Bootstrap the correlation of two aligned return series, resampling
+// periods jointly.
+func bootstrapCorrelation(returns1 []float64, returns2 []float64, opts BootstrapOptions) (ConfidenceInterval, error) {
+	n := len(returns1)
+	opts, err := opts.withDefaults(n)
+	if err != nil { return ConfidenceInterval{}, err }
+	rng := rand.New(rand.NewSource(*opts.Seed))
+	corrs := make([]float64, opts.Samples)
+	sample1 := make([]float64, n)
+	sample2 := make([]float64, n)
+	for i := range corrs {
+		for k, index := range blockBootstrapIndexes(rng, n, opts.BlockLength) {
+			sample1[k] = returns1[index]
+			sample2[k] = returns2[index]
+		}
+		corrs[i] = pearson(sample1, sample2)
+	}
+	return percentileInterval(pearson(returns1, returns2), corrs, opts.Confidence), nil
+}
+
+func checkBootstrapPeriods(returns []float64, what string) error {
+	if len(returns) < 2 {
+		return fmt.Errorf("%w: %s has %d returns, need at least 2 to bootstrap", ErrNoOverlap, what, len(returns))
+	}
+	return nil
+}
+
+// Bootstrap confidence intervals for the stats of the ticker over r.
+func (db *Database) BootstrapStats(ticker string, r *dateRange, opts BootstrapOptions) (*BootstrapStats, error) {
+	js, err := db.jointStats([]string{ticker}, r)
+	if err != nil { return nil, err }
+	returns := periodReturns(js.prices[0])
+	if err := checkBootstrapPeriods(returns, ticker); err != nil { return nil, err }
+	riskFree, err := db.riskFreeReturns(js.dates)
+	if err != nil { return nil, err }
+	return bootstrapReturns(returns, riskFree, opts)
+}
+
+// Bootstrap confidence interval for the correlation of the simple returns
+// of the two tickers over the periods of r in which both have prices.
+func (db *Database) BootstrapCorrelation(ticker1 string, ticker2 string, r *dateRange, opts BootstrapOptions) (ConfidenceInterval, error) {
+	js, err := db.jointStats([]string{ticker1, ticker2}, r)
+	if err != nil { return ConfidenceInterval{}, err }
+	returns1 := periodReturns(js.prices[0])
+	if err := checkBootstrapPeriods(returns1, ticker1); err != nil { return ConfidenceInterval{}, err }
+	return bootstrapCorrelation(returns1, periodReturns(js.prices[1]), opts)
+}
+
+// Bootstrap confidence intervals for the stats of the portfolio,
+// rebalanced to its weights every sampling period.
+func (p *Portfolio) BootstrapStats(opts BootstrapOptions) (*BootstrapStats, error) {
+	tickers, weights := p.normalizedWeights()
+	js, err := p.Db().jointStats(tickers, p.DateRange())
+	if err != nil { return nil, err }
+	returns := periodReturns(rebalancedValues(js, weights))
+	if err := checkBootstrapPeriods(returns, "portfolio"); err != nil { return nil, err }
+	riskFree, err := p.Db().riskFreeReturns(js.dates)
+	if err != nil { return nil, err }
+	return bootstrapReturns(returns, riskFree, opts)
+}
+
+// The uncertainty of a point on a frontier of portfolios.
+type FrontierBand struct {
+	Portfolio *Portfolio
+	Mean ConfidenceInterval
+	Volatility ConfidenceInterval
+}
+
+// The per-period returns, of the type selected by SetReturnType, of a
+// portfolio whose per-period return is the weighted sum of those of the
+// securities, as in Portfolio.Stats.
+func weightedReturns(js *jointStats, weights []float64, t ReturnType) []float64 {
+	returns := make([]float64, len(js.dates) - 1)
+	for k := range returns {
+		for i, w := range weights {
+			returns[k] += w * t.delta(js.prices[i][k + 1], js.prices[i][k])
+		}
+	}
+	return returns
+}
+
+// Bootstrap the frontier coordinates of returns, the per-period return
+// and volatility that Portfolio.Stats would report for them.
+func bootstrapFrontierPoint(returns []float64, opts BootstrapOptions) (ConfidenceInterval, ConfidenceInterval, error) {
+	n := len(returns)
+	opts, err := opts.withDefaults(n)
+	if err != nil { return ConfidenceInterval{}, ConfidenceInterval{}, err }
+	rng := rand.New(rand.NewSource(*opts.Seed))
+	means := make([]float64, opts.Samples)
+	vols := make([]float64, opts.Samples)
+	sample := make([]float64, n)
+	for i := range means {
+		for k, index := range blockBootstrapIndexes(rng, n, opts.BlockLength) {
+			sample[k] = returns[index]
+		}
+		means[i], vols[i], _, _ = moments(sample)
+	}
+	mean, vol, _, _ := moments(returns)
+	return percentileInterval(mean, means, opts.Confidence), percentileInterval(vol, vols, opts.Confidence), nil
+}
+
+// Bootstrap the point of each portfolio on the frontier, in order of
+// increasing mean. Every item of the frontier must be a *Portfolio,
+// inserted at its PerPeriodReturn and Volatility. The samples use the
+// sample covariance regardless of the CovarianceEstimator; the estimates
+// are the item's own coordinates.
+func (f *frontier) Bands(opts BootstrapOptions) ([]FrontierBand, error) {
+	bands := []FrontierBand{}
+	for iter := f.Iterate(); !iter.Done(); iter = iter.Next() {
+		p, ok := iter.Item().(*Portfolio)
+		if !ok {
+			return nil, fmt.Errorf("Frontier item %v is not a portfolio", iter.Item())
+		}
+		tickers, weights := p.normalizedWeights()
+		js, err := p.Db().jointStats(tickers, p.DateRange())
+		if err != nil { return nil, err }
+		returns := weightedReturns(js, weights, p.Db().ReturnType())
+		if err := checkBootstrapPeriods(returns, "portfolio"); err != nil { return nil, err }
+		mean, vol, err := bootstrapFrontierPoint(returns, opts)
+		if err != nil { return nil, err }
+		mean.Estimate, vol.Estimate = iter.Mean(), iter.Stddev()
+		bands = append(bands, FrontierBand{p, mean, vol})
+	}
+	return bands, nil
+}
@@ -0,0 +1,98 @@
+package portopt
+
+import "math"
+import "math/rand"
+import "testing"
+
+func TestBlockBootstrapIndexes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	indexes := blockBootstrapIndexes(rng, 10, 3)
+	if len(indexes) != 10 { t.Fatal(indexes) }
+	for k := 1; k < len(indexes); k++ {
+		// Within a block, indexes are consecutive, wrapping around.
+		if k % 3 != 0 && indexes[k] != (indexes[k - 1] + 1) % 10 { t.Error(indexes) }
+	}
+}
+
+func TestBootstrapReturns(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	returns := make([]float64, 240)
+	riskFree := make([]float64, 240)
+	for k := range returns {
+		returns[k] = 0.01 + 0.05 * rng.NormFloat64()
+	}
+	stats, err := bootstrapReturns(returns, riskFree, BootstrapOptions{Samples: 500})
+	if err != nil { t.Fatal(err) }
+	if stats.Confidence != 0.95 { t.Error(stats) }
+	for _, ci := range []ConfidenceInterval{stats.Mean, stats.Volatility, stats.Sharpe} {
+		if !(ci.Low < ci.Estimate && ci.Estimate < ci.High) { t.Error(ci) }
+	}
+	// The standard error of the mean is about 0.05 / sqrt(240).
+	width := stats.Mean.High - stats.Mean.Low
+	if width < 0.005 || width > 0.02 { t.Error(stats.Mean) }
+
+	again, err := bootstrapReturns(returns, riskFree, BootstrapOptions{Samples: 500})
+	if err != nil { t.Fatal(err) }
+	if *again != *stats { t.Error("Not reproducible: ", again, stats) }
+	narrow, err := bootstrapReturns(returns, riskFree, BootstrapOptions{Samples: 500, Confidence: 0.5})
+	if err != nil { t.Fatal(err) }
+	if narrow.Mean.High - narrow.Mean.Low >= width { t.Error(narrow.Mean, stats.Mean) }
+
+	// Seed 0 is a seed like any other, not the default.
+	seed := int64(0)
+	zero, err := bootstrapReturns(returns, riskFree, BootstrapOptions{Samples: 500, Seed: &seed})
+	if err != nil { t.Fatal(err) }
+	if *zero == *stats { t.Error("Seed 0 gave the default seed's results: ", zero) }
+
+	for _, c := range []float64{-0.5, 1, 95} {
+		_, err := bootstrapReturns(returns, riskFree, BootstrapOptions{Confidence: c})
+		if err == nil { t.Error("Accepted confidence ", c) }
+	}
+
+	ci, err := bootstrapCorrelation(returns, returns, BootstrapOptions{})
+	if err != nil { t.Fatal(err) }
+	if math.Abs(ci.Estimate - 1) > 1e-12 || math.Abs(ci.Low - 1) > 1e-12 { t.Error(ci) }
+}
+
+func TestBootstrapStats_Database(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+
+	opts := BootstrapOptions{Samples: 200}
+	stats, err := db.BootstrapStats("C", allTime, opts)
+	if err != nil { t.Fatal(err) }
+	if !(stats.Volatility.Low < stats.Volatility.Estimate && stats.Volatility.Estimate < stats.Volatility.High) { t.Error(stats) }
+	ci, err := db.BootstrapCorrelation("C", "D", allTime, opts)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(ci.Estimate - 1) > 1e-9 { t.Error(ci) }
+
+	p := NewPortfolio(db, allTime, map[string]float64{"C": 1.0, "D": 1.0})
+	f := newFrontier()
+	pstats, err := p.Stats()
+	if err != nil { t.Fatal(err) }
+	f.Insert(pstats.PerPeriodReturn(), pstats.Volatility(), p)
+	bands, err := f.Bands(opts)
+	if err != nil { t.Fatal(err) }
+	if len(bands) != 1 || bands[0].Portfolio != p { t.Fatal(bands) }
+	band := bands[0]
+	if band.Mean.Estimate != pstats.PerPeriodReturn() || band.Volatility.Estimate != pstats.Volatility() { t.Error(band, pstats) }
+	if !(band.Mean.Low < band.Mean.Estimate && band.Mean.Estimate < band.Mean.High) ||
+		!(band.Volatility.Low < band.Volatility.Estimate && band.Volatility.Estimate < band.Volatility.High) {
+		t.Error(band)
+	}
+
+	// The samples use the estimators of Portfolio.Stats.
+	tickers, weights := p.normalizedWeights()
+	js, err := db.jointStats(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	mean, vol, _, _ := moments(weightedReturns(js, weights, db.ReturnType()))
+	if math.Abs(mean - pstats.PerPeriodReturn()) > 1e-12 || math.Abs(vol - pstats.Volatility()) > 1e-12 {
+		t.Error(mean, vol, pstats)
+	}
+
+	f.Insert(pstats.PerPeriodReturn() + 1, pstats.Volatility() + 1, "not a portfolio")
+	if _, err := f.Bands(opts); err == nil { t.Error("Expect an error for a non-portfolio item") }
+}
@@ -0,0 +1,54 @@
+// Command portoptdb inspects and maintains a portopt price database.
+//
+// Usage:
+//
+//	portoptdb -db <path> schema
+//
+// "schema" reports the schema version of the database and the migrations
+// that opening it with portopt.CreateDb would apply.
+package main
+
+import "flag"
+import "fmt"
+import "log"
+import "os"
+import "ysaito.com/portopt"
+
+var dbPath = flag.String("db", "", "Path of the SQLite database")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s -db <path> schema\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func schema() {
+	version, pending, err := portopt.SchemaStatus(*dbPath)
+	if err != nil {
+		log.Fatal(*dbPath, ": ", err)
+	}
+	fmt.Printf("%s: schema version %d (latest %d)\n",
+		*dbPath, version, portopt.LatestSchemaVersion())
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations")
+		return
+	}
+	fmt.Printf("%d pending migrations:\n", len(pending))
+	for _, m := range pending {
+		fmt.Printf("  %d: %s\n", m.Version, m.Description)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *dbPath == "" || flag.NArg() != 1 {
+		usage()
+	}
+	switch flag.Arg(0) {
+	case "schema":
+		schema()
+	default:
+		usage()
+	}
+}
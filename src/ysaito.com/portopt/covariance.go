@@ -0,0 +1,117 @@
+package portopt
+
+import "fmt"
+import "math"
+import "strings"
+import "time"
+
+// Statistics of a set of securities, computed over the same periods.
+type jointStats struct {
+	// The periods used: the intersection of the requested range and the
+	// price histories of every ticker.
+	dateRange *dateRange
+
+	means []float64  // per-period (unweighted) return of each ticker
+
+	// The aligned prices: prices[i][k] is of tickers[i] for the period
+	// that starts at dates[k].
+	dates []time.Time
+	prices [][]float64
+
+	// Estimated by the database's CovarianceEstimator.
+	covariance *Matrix
+	correlation *Matrix
+
+	// The shrinkage intensity used for covariance; 0 for
+	// SampleCovariance.
+	shrinkage float64
+}
+
+// Key of Database.matrixCache.
+type jointStatsKey struct {
+	tickers string  // tickers joined by "\x00"
+	r dateRangeKey
+}
+
+// Compute the means, covariances and correlations of the per-period returns
+// of the tickers, over the periods of r for which every ticker has a price.
+// The prices are aligned once for all tickers, and the result is cached as
+// a unit.
+func (db *Database) jointStats(tickers []string, r *dateRange) (*jointStats, error) {
+	series := make([]*PriceSeries, len(tickers))
+	common := r
+	for i, ticker := range tickers {
+		s, err := db.FindSecurity(ticker)
+		if err != nil { return nil, err }
+		series[i] = s.prices
+		common = common.Intersect(s.prices.DateRange())
+	}
+	if common.Empty() {
+		return nil, fmt.Errorf("%w: %v, requested %v", ErrNoOverlap, tickers, r)
+	}
+	key := jointStatsKey{strings.Join(tickers, "\x00"), common.Key()}
+	if cached, found := db.matrixCache.Get(key); found {
+		return cached.(*jointStats), nil
+	}
+
+	dates, prices, err := alignPricesWithDates(common, db.missingData, series...)
+	if err != nil { return nil, err }
+	accs := make([]*statsAccumulator, len(tickers))
+	for i, ticker := range tickers {
+		accs[i] = db.newAccumulator(ticker)
+		for _, price := range prices[i] {
+			accs[i].Add(price)
+		}
+	}
+
+	js := &jointStats{
+		dateRange: common,
+		dates: dates,
+		prices: prices,
+		means: make([]float64, len(tickers)),
+		correlation: newMatrix(tickers),
+	}
+	decay := db.ewmaDecay(common)
+	sample := newMatrix(tickers)
+	returns := make([][]float64, len(tickers))
+	for i := range tickers {
+		js.means[i] = accs[i].PerPeriodReturn()
+		for period := 1; period < accs[i].NumItems(); period++ {
+			returns[i] = append(returns[i], accs[i].DeltaForPeriod(period))
+		}
+		for j := 0; j <= i; j++ {
+			cov := covariance(accs[i], accs[j])
+			if db.covariance == EwmaCovariance {
+				cov = ewmaCovariance(accs[i], accs[j], decay)
+			}
+			sample.set(i, j, cov)
+			sample.set(j, i, cov)
+		}
+	}
+	js.covariance, js.shrinkage = shrinkCovariance(db.covariance, returns, sample)
+	for i := range tickers {
+		for j := range tickers {
+			js.correlation.set(i, j, js.covariance.At(i, j) /
+				math.Sqrt(js.covariance.At(i, i) * js.covariance.At(j, j)))
+		}
+	}
+	db.matrixCache.Put(key, js)
+	return js, nil
+}
+
+// Covariance matrix of the per-period returns of the tickers, over the
+// periods of r for which every ticker has a price, estimated as set by
+// SetCovarianceEstimator. Row and column i are for tickers[i].
+func (db *Database) CovarianceMatrix(tickers []string, r *dateRange) (*Matrix, error) {
+	js, err := db.jointStats(tickers, r)
+	if err != nil { return nil, err }
+	return js.covariance, nil
+}
+
+// Correlation matrix of the per-period returns of the tickers. See
+// CovarianceMatrix.
+func (db *Database) CorrelationMatrix(tickers []string, r *dateRange) (*Matrix, error) {
+	js, err := db.jointStats(tickers, r)
+	if err != nil { return nil, err }
+	return js.correlation, nil
+}
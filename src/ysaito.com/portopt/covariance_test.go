@@ -0,0 +1,41 @@
+package portopt
+
+import "math"
+import "testing"
+
+func TestCovarianceMatrix(t *testing.T) {
+	// Means 1/30 and 0.01.
+	f := newStatsFixture(t, "A", map[string][]float64{
+		"A": compound(0.1, -0.1, 0.1),
+		"B": compound(0.02, -0.04, 0.05),
+	})
+	db := f.db
+
+	tickers := []string{"A", "B"}
+	cov, err := db.CovarianceMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	if cov.N() != 2 || cov.Index("B") != 1 || cov.Index("E") != -1 { t.Fatal(cov) }
+	// E.g., (0.1 * 0.02 + 0.1 * 0.04 + 0.1 * 0.05) / 3 - 0.01 / 30.
+	want := [][]float64{{8.0 / 900, 1.0 / 300}, {1.0 / 300, 0.0014}}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			if math.Abs(cov.At(i, j) - want[i][j]) > 1e-12 { t.Error(i, j, cov.At(i, j), want[i][j]) }
+		}
+	}
+	if math.Abs(f.stats.Stddev - math.Sqrt(8.0 / 900)) > 1e-12 { t.Error(f.stats) }
+
+	corr, err := db.CorrelationMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	c, err := db.Correlation("A", "B", allTime)
+	if err != nil { t.Fatal(err) }
+	wantCorr := (1.0 / 300) / math.Sqrt(8.0 / 900 * 0.0014)
+	if math.Abs(corr.At(0, 1) - wantCorr) > 1e-9 || math.Abs(c - wantCorr) > 1e-9 || corr.At(1, 1) != 1 {
+		t.Error(corr, c, wantCorr)
+	}
+
+	// Both matrices come from a single cached computation.
+	before := db.matrixCache.Counters()
+	_, err = db.CovarianceMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	if after := db.matrixCache.Counters(); after.Hits != before.Hits + 1 || after.Entries != before.Entries { t.Error(after, before) }
+}
@@ -7,36 +7,76 @@ package portopt;
 import "github.com/kuroneko/gosqlite3"
 import "time"
 import "os"
-import "net/http"
 import "log"
-import "encoding/csv"
 import "regexp"
-import "strconv"
+import "errors"
 import "fmt"
+import "math"
 
 var dateRe *regexp.Regexp
 
 type Database struct {
 	Path string
 	db *sqlite3.Database
+
+	// Price sources consulted, in order, when a ticker is missing or
+	// stale.
+	sources []PriceSource
+
+	// How Stats and Correlation treat periods without a quote.
+	missingData MissingDataPolicy
+
+	// How CovarianceMatrix and Portfolio.Stats estimate covariances.
+	covariance CovarianceEstimator
+
+	// Half-life of the exponentially weighted statistics.
+	ewmaHalfLife time.Duration
+
+	// The returns that Stats and Correlation are computed over.
+	returnType ReturnType
+
+	// Annual return below which DownsideRisk counts a loss.
+	minAcceptableReturn float64
+
+	// Confidence levels of the ValueAtRisk in the stats.
+	varLevels []float64
+
+	// What PortfolioStats.Risk measures.
+	riskMeasure RiskMeasure
+
+	// The risk-free rates, or nil if not read from the riskfree table
+	// yet. constantRiskFree is true if set by SetRiskFreeRate.
+	riskFree []riskFreeQuote
+	constantRiskFree bool
+
+	// When FindSecurity fetches new prices.
+	refresh RefreshPolicy
+
 	cachedSecurities map[string]*Security
-	correlationCache map[TickerPair]float64
+
+	// statsKey -> SecurityStats
+	statsCache *lruCache
+
+	// correlationKey -> float64
+	correlationCache *lruCache
+
+	// jointStatsKey -> *jointStats
+	matrixCache *lruCache
 };
 
+// Default capacity of the stats and correlation caches.
+const defaultCacheSize = 10000
+
 // Cache of database entry.
 type Security struct {
 	Ticker string
 	Weight float64
 
-	// The date range for which the priceMap is defined
-	priceDateRange *dateRange
+	// Adjusted closing prices, as reported by yahoo.
+	prices *PriceSeries
 
-	// Date (UNIX time) -> Adjusted closing price, as reported by yahoo.
-	priceMap map[int64]float64
-
-	// Cache of previously computed security stats. The key must
-	// be a subrange of this.dateRange.
-	statsCache map[*dateRange]SecurityStats
+	// When prices were read from the price table.
+	loadTime time.Time
 };
 
 type TickerPair struct {
@@ -44,46 +84,126 @@ type TickerPair struct {
 	ticker2 string
 }
 
+// The pair, with ticker1 <= ticker2, and the periods the correlation is
+// computed over.
+type correlationKey struct {
+	TickerPair
+	r dateRangeKey
+}
+
+// The ticker and the periods the stats are computed over.
+type statsKey struct {
+	ticker string
+	r dateRangeKey
+}
+
+// Statistics of a security's returns over the sampling periods of a date
+// range. PerPeriodReturn, Stddev and EwmaStddev are of the returns
+// selected by SetReturnType; the other fields don't depend on it.
 type SecurityStats struct {
+	// Mean of the per-period returns; equals ArithmeticMean for
+	// SimpleReturns.
 	PerPeriodReturn float64
+
+	// Mean of the simple returns. Overstates long-run growth for volatile
+	// securities; see GeometricMean.
 	ArithmeticMean float64
 	Stddev float64
+
+	// The compound return per period.
+	GeometricMean float64
+
+	// GeometricMean compounded over a year.
+	CAGR float64
+
+	// Growth from the first to the last price, minus 1.
+	TotalReturn float64
+
+	// Standard deviation with recent periods weighted more heavily. See
+	// SetEwmaHalfLife.
+	EwmaStddev float64
+
+	DownsideRisk
+
+	// At each of the database's VaRConfidenceLevels.
+	VaR []ValueAtRisk
+
+	HigherMoments
+	ExcessReturns
+
+	// Sampling periods in a year, for the date range the stats were
+	// computed over.
+	periodsPerYear float64
+}
+
+// PerPeriodReturn times the number of periods in a year. Unlike the
+// per-period figures, annualized ones can be compared across sampling
+// intervals.
+func (s SecurityStats) AnnualizedReturn() float64 {
+	return s.PerPeriodReturn * s.periodsPerYear
+}
+
+// Stddev scaled to a year, assuming independent returns.
+func (s SecurityStats) AnnualizedStddev() float64 {
+	return s.Stddev * math.Sqrt(s.periodsPerYear)
+}
+
+// Sharpe scaled to a year, assuming independent returns.
+func (s SecurityStats) AnnualizedSharpe() float64 {
+	return s.Sharpe * math.Sqrt(s.periodsPerYear)
 }
 
 func (db *Database) Stats(ticker string, r *dateRange) (SecurityStats, error) {
 	var stats SecurityStats;
-	acc := newStatsAccumulator(ticker);
+	acc := db.newAccumulator(ticker);
 
 	s1, err := db.FindSecurity(ticker)
 	if err != nil { return stats, err }
 
-	stats, found := s1.statsCache[r]
-	if found {
-		return stats, nil
+	thisRange := s1.prices.DateRange().Intersect(r)
+	if thisRange.Empty() {
+		return stats, fmt.Errorf("%w: %s has prices for %v, requested %v",
+			ErrNoOverlap, ticker, s1.prices.DateRange(), r)
+	}
+	key := statsKey{ticker, thisRange.Key()}
+	if cached, found := db.statsCache.Get(key); found {
+		return cached.(SecurityStats), nil
 	}
 
-	thisRange := s1.priceDateRange.Intersect(r)
-
-	for i := thisRange.Begin(); !i.Done(); i.Next() {
-		t := i.Time().Unix()
-		acc.Add(s1.priceMap[t])
+	dates, prices, err := alignPricesWithDates(thisRange, db.missingData, s1.prices)
+	if err != nil { return stats, err }
+	for _, price := range prices[0] {
+		acc.Add(price)
 	}
 	stats.PerPeriodReturn = acc.PerPeriodReturn()
 	stats.ArithmeticMean = acc.ArithmeticMean()
 	stats.Stddev = acc.StdDev()
-	s1.statsCache[r] = stats
-	log.Print("Stats: ", ticker, " ", s1.priceDateRange.String(), " ", r.String(), " return=", stats.PerPeriodReturn, " stddev=", stats.Stddev, " mean=", stats.ArithmeticMean)
+	stats.EwmaStddev = acc.EwmaStdDev(db.ewmaDecay(thisRange))
+	stats.GeometricMean = acc.GeometricMean()
+	stats.CAGR = math.Pow(1 + stats.GeometricMean, thisRange.PeriodsPerYear()) - 1
+	stats.TotalReturn = acc.TotalReturn()
+	stats.periodsPerYear = thisRange.PeriodsPerYear()
+	stats.DownsideRisk = downsideRisk(dates, prices[0], db.minAcceptableReturn, stats.periodsPerYear)
+	returns := periodReturns(prices[0])
+	stats.VaR = valueAtRisk(returns, db.varLevels)
+	stats.HigherMoments = higherMoments(returns)
+	riskFree, err := db.riskFreeReturns(dates)
+	if err != nil { return stats, err }
+	stats.ExcessReturns = excessReturns(returns, riskFree)
+	db.statsCache.Put(key, stats)
+	log.Print("Stats: ", ticker, " ", s1.prices.DateRange().String(), " ", r.String(), " return=", stats.PerPeriodReturn, " stddev=", stats.Stddev, " mean=", stats.ArithmeticMean)
 	return stats, nil
 }
 
-func (db *Database) Correlation (ticker1 string, ticker2 string) (float64, error) {
+// Correlation of the per-period returns of the two tickers over the
+// periods of r for which both have prices. Zero if either has constant
+// prices, e.g., a money market fund.
+func (db *Database) Correlation(ticker1 string, ticker2 string, r *dateRange) (float64, error) {
 	p := TickerPair{ ticker1: ticker1, ticker2 : ticker2 }
 	// if p.ticker1 == p.ticker2 { return 1.0, nil }
 	if p.ticker1 > p.ticker2 {
 		p.ticker1, p.ticker2 = p.ticker2, p.ticker1
 	}
-	corr, found := db.correlationCache[p]
-	if found { return corr, nil }
 
 	s1, err := db.FindSecurity(ticker1)
 	if err != nil { return -1.0, err }
@@ -91,249 +211,425 @@ func (db *Database) Correlation (ticker1 string, ticker2 string) (float64, error
 	s2, err := db.FindSecurity(ticker2)
 	if err != nil { return -1.0, err }
 
-	dateRange := s1.priceDateRange.Intersect(s2.priceDateRange)
-	stats1 := newStatsAccumulator(ticker1)
-	stats2 := newStatsAccumulator(ticker2)
+	dateRange := s1.prices.DateRange().Intersect(s2.prices.DateRange()).Intersect(r)
+	if dateRange.Empty() {
+		return -1.0, fmt.Errorf("%w: %s %v, %s %v, requested %v",
+			ErrNoOverlap, ticker1, s1.prices.DateRange(), ticker2, s2.prices.DateRange(), r)
+	}
+	key := correlationKey{p, dateRange.Key()}
+	if cached, found := db.correlationCache.Get(key); found {
+		return cached.(float64), nil
+	}
 
-	for i := dateRange.Begin(); !i.Done(); i.Next() {
-		t := i.Time().Unix()
-		stats1.Add(s1.priceMap[t])
-		stats2.Add(s2.priceMap[t])
+	corr, found, err := db.loadCorrelation(p, dateRange)
+	if err != nil { return -1.0, err }
+	if found {
+		db.correlationCache.Put(key, corr)
+		return corr, nil
+	}
+
+	stats1 := db.newAccumulator(ticker1)
+	stats2 := db.newAccumulator(ticker2)
+
+	prices, err := alignPrices(dateRange, db.missingData, s1.prices, s2.prices)
+	if err != nil { return -1.0, err }
+	for i := range prices[0] {
+		stats1.Add(prices[0][i])
+		stats2.Add(prices[1][i])
 	}
 
-	var diffTotal float64 = 0.0
-	for period := 0; period < stats1.NumItems(); period++ {
-		diffTotal += stats1.DeltaForPeriod(period) * stats2.DeltaForPeriod(period)
+	corr = 0
+	if stats1.StdDev() > 0 && stats2.StdDev() > 0 {
+		corr = covariance(stats1, stats2) / stats1.StdDev() / stats2.StdDev()
+	}
+	// SQLite would store NaN as NULL.
+	if !math.IsNaN(corr) && !math.IsInf(corr, 0) {
+		if err := db.storeCorrelation(p, dateRange, corr); err != nil {
+			return -1.0, err
+		}
 	}
-	corr = diffTotal / float64(stats1.NumItems()) / stats1.StdDev() / stats2.StdDev()
-	db.correlationCache[p] = corr
+	db.correlationCache.Put(key, corr)
 	return corr, nil
 }
 
-func searchPrice(db *Database,
-	ticker string,
-	date time.Time,
-	interval time.Duration) (float64) {
-	price := -1.0
-	limitDate := date.Add(interval)
-	db.MustRunQuery(fmt.Sprintf(
-		"SELECT adjclose from price WHERE ticker = '%s' AND date >= %d AND date < %d ORDER BY date LIMIT 1",
-		ticker, date.Unix(), limitDate.Unix()),
-		func(val... interface{}) {
-		price = val[0].(float64)
-	})
-	return price
+// Look up a correlation computed by an earlier Correlation call, possibly
+// by another process. Rows are keyed by the ticker pair, the date range,
+// the missing data policy and the return type. insertQuotes deletes the rows of a ticker
+// whenever its prices change.
+func (db *Database) loadCorrelation(p TickerPair, r *dateRange) (float64, bool, error) {
+	rows, err := db.Query(
+		"SELECT corr FROM correlation WHERE ticker1 = ? AND ticker2 = ? AND startDate = ? AND endDate = ? AND samplingInterval = ? AND missingData = ? AND returnType = ?",
+		p.ticker1, p.ticker2, r.Start().Unix(), r.End().Unix(),
+		int64(r.samplingInterval / time.Second), int64(db.missingData), int64(db.returnType))
+	if err != nil || len(rows) == 0 {
+		return -1.0, false, err
+	}
+	corr, ok := rows[0][0].(float64)
+	if !ok {
+		// E.g., a NaN stored as NULL by an older version.
+		return -1.0, false, nil
+	}
+	return corr, true, nil
+}
+
+func (db *Database) storeCorrelation(p TickerPair, r *dateRange, corr float64) (error) {
+	return db.Exec(
+		"INSERT OR REPLACE INTO correlation VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		p.ticker1, p.ticker2, corr, time.Now().Unix(),
+		r.Start().Unix(), r.End().Unix(),
+		int64(r.samplingInterval / time.Second), int64(db.missingData), int64(db.returnType))
+}
+
+// Read the whole price history of the ticker in one query and bucket it
+// into sampling periods of minInterval. Each period gets the first quote
+// that falls in it. Periods without quotes are gaps in the series.
+func (db *Database) loadPrices(ticker string) (*PriceSeries, error) {
+	rows, err := db.Query(
+		"SELECT date, adjclose FROM price WHERE ticker = ? ORDER BY date", ticker)
+	if err != nil { return nil, err }
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no prices for %s", ErrUnknownTicker, ticker)
+	}
+	r := NewDateRange(
+		time.Unix(rows[0][0].(int64), 0),
+		time.Unix(rows[len(rows) - 1][0].(int64), 0),
+		minInterval)
+	start := r.Start().Unix()
+	intervalSecs := int64(r.samplingInterval / time.Second)
+
+	prices := newPriceSeries(ticker, r)
+	for _, row := range rows {
+		i := int((row[0].(int64) - start) / intervalSecs)
+		if !prices.present[i] {
+			prices.set(i, row[1].(float64))
+		}
+	}
+	return prices, nil
 }
 
+// Find the security in the cache, or load it from the price table. Missing
+// or stale prices are first fetched from the price sources according to
+// the refresh policy; see RefreshPolicy.
 func (db *Database) FindSecurity(ticker string) (*Security, error) {
+	now := time.Now()
 	s, found := db.cachedSecurities[ticker]
-	if found {
-		// TODO: check staleness
+	if found && !db.refresh.recheck(s.loadTime, now) {
 		return s, nil
 	}
 
-	now := time.Now()
-	r := db.GetDateRange(ticker)
-	if r.Empty() || (now.Sub(r.End()) >= time.Hour * 24 * 30 * 2) {
-		log.Print("Filling ", ticker, " from interweb, range=", r.String(), now.Sub(r.End()))
-		err := db.fillFromYahoo(ticker)
-		if err != nil { return nil, err }
+	last, err := db.lastQuoteDate(ticker)
+	if err != nil { return nil, err }
+	if db.refresh.stale(last, !found, now) {
+		log.Print("Filling ", ticker, " from price sources, last quote=", last)
+		err := db.fillFromSources(ticker, last)
+		if err != nil {
+			if last.IsZero() { return nil, err }
+			// Make do with the stale prices we already have.
+			log.Print("Failed to refresh ", ticker, ": ", err)
+		}
+	}
+	if found {
+		db.forget(ticker)
 	}
 	s = new(Security)
 	s.Ticker = ticker
-	s.priceMap = make(map[int64]float64)
-	s.statsCache = make(map[*dateRange]SecurityStats)
-
-	var minDate time.Time
-	var maxDate time.Time
-	for i := r.Begin(); !i.Done(); i.Next() {
-		price := searchPrice(db, ticker, i.Time(), minInterval)
-		if price >= 0.0 {
-			if minDate.IsZero() || minDate.After(i.Time()) {
-				minDate = i.Time()
-			}
-			if maxDate.IsZero() || maxDate.Before(i.Time()) {
-				maxDate = i.Time()
-			}
-			s.priceMap[i.Time().Unix()] = price
-		} else {
-			break;
-		}
-	}
-	s.priceDateRange = NewDateRange(minDate, maxDate, minInterval)
+	s.loadTime = now
+	s.prices, err = db.loadPrices(ticker)
+	if err != nil { return nil, err }
 	db.cachedSecurities[ticker] = s
 	return s, nil;
 }
 
-func PanicOnError(err error, params... interface{}) {
-	if err != nil {
-		pp := params;
-		log.Fatal(append(pp, ": ", err));
-		log.Fatal(err)
-	}
+// The sampled price history of the security.
+func (s *Security) Prices() *PriceSeries { return s.prices }
+
+// Set how Stats and Correlation treat sampling periods in which a
+// security has no quote. The default is DropMissing.
+func (db *Database) SetMissingDataPolicy(policy MissingDataPolicy) {
+	db.missingData = policy
+	db.statsCache.Clear()
+	db.correlationCache.Clear()
+	db.matrixCache.Clear()
 }
 
-func mustParseDecimal(s string) (int) {
-	value, err := strconv.ParseInt(s, 10, 64)
-	PanicOnError(err, "Failed to parse ", s, " as a decimal string")
-	return int(value)
+func (db *Database) MissingDataPolicy() MissingDataPolicy { return db.missingData }
+
+// Bound the stats, correlation and matrix caches to n entries each.
+func (db *Database) SetCacheSize(n int) {
+	db.statsCache.Resize(n)
+	db.correlationCache.Resize(n)
+	db.matrixCache.Resize(n)
 }
 
-func mustParseFloat(s string) (float64) {
-	value, err := strconv.ParseFloat(s, 64)
-	PanicOnError(err, "Failed to parse ", s, " as a float string")
-	return value
+// Hit and miss counts of the cache used by Stats.
+func (db *Database) StatsCacheCounters() CacheCounters {
+	return db.statsCache.Counters()
 }
 
-func (db Database) MustUpdate(sql string) {
-	st, err := db.db.Prepare(sql)
-	PanicOnError(err, "failed to prepare SQL: ", sql)
-	st.Step()
-	PanicOnError(st.Finalize(), "blah")
+// Hit and miss counts of the in-memory cache used by Correlation.
+func (db *Database) CorrelationCacheCounters() CacheCounters {
+	return db.correlationCache.Counters()
 }
 
-func (db Database) MustPrepare(sql string) (*sqlite3.Statement) {
-	st, err := db.db.Prepare(sql)
-	PanicOnError(err, "select " + sql)
-	return st
+// Run a SQL statement that returns no rows. Each "?" in sql is bound to
+// the next element of args.
+func (db Database) Exec(sql string, args... interface{}) (error) {
+	st, err := db.db.Prepare(sql, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %v", sql, err)
+	}
+	err = st.Step()
+	if ferr := st.Finalize(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", sql, err)
+	}
+	return nil
 }
 
-func (db Database) MustRunQuery(sql string, cb func(val... interface{})) {
-	st := db.MustPrepare(sql)
-	_, err := st.All(func(st *sqlite3.Statement, val... interface{}) {
-		cb(val...)
+// Run a SQL query and return all the rows it produces. Each "?" in sql is
+// bound to the next element of args.
+func (db Database) Query(sql string, args... interface{}) ([][]interface{}, error) {
+	st, err := db.db.Prepare(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", sql, err)
+	}
+	rows := [][]interface{}{}
+	_, err = st.All(func(st *sqlite3.Statement, val... interface{}) {
+		row := make([]interface{}, len(val))
+		copy(row, val)
+		rows = append(rows, row)
 	})
-	PanicOnError(err, "Failed to run query "+ sql)
+	if ferr := st.Finalize(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", sql, err)
+	}
+	return rows, nil
 }
 
-func (db Database) FillFromCsv(path string, ticker string) (error) {
-	file, err := os.Open(path)
-	if err != nil {
+// Run f inside a transaction. The transaction is rolled back if f fails.
+func (db Database) inTransaction(f func() error) (error) {
+	if err := db.Exec("BEGIN TRANSACTION"); err != nil {
 		return err
 	}
-	reader := csv.NewReader(file)
-	r, err := reader.ReadAll()
-	if err != nil {
+	if err := f(); err != nil {
+		db.Exec("ROLLBACK TRANSACTION")
 		return err
 	}
-	db.MustUpdate("BEGIN TRANSACTION");
-	for _, line := range r {
-		matches := dateRe.FindStringSubmatch(line[0])
-		if (matches == nil) {
-			continue;
-		}
-		date := time.Date(mustParseDecimal(matches[1]),
-			time.Month(mustParseDecimal(matches[2])),
-			mustParseDecimal(matches[3]),
-			0, 0, 0, 0, time.UTC)
-		sql := fmt.Sprintf("INSERT INTO price values('C', %d, %f, %f, %f, %f, %d, %f)",
-			date.Unix(),
-			mustParseFloat(line[1]),
-			mustParseFloat(line[2]),
-			mustParseFloat(line[3]),
-			mustParseFloat(line[4]),
-			mustParseDecimal(line[5]),
-			mustParseFloat(line[6]));
-		db.MustUpdate(sql)
-	}
-	db.MustUpdate("COMMIT TRANSACTION");
-	return nil
+	return db.Exec("COMMIT TRANSACTION")
 }
 
-func (db Database) fillFromYahoo(ticker string) (error) {
-	url := fmt.Sprintf("http://ichart.finance.yahoo.com/table.csv?s=%s&a=00&b=0&c=1980&d=01&e=1&f=2015&g=d&ignore=.csv", ticker)
-	resp, err := http.Get(url)
+// Import a price CSV file, such as one downloaded from Yahoo, into the
+// price table under the given ticker. The first row of the file must be a
+// header naming the columns; see parsePriceCsv. Existing rows for the same
+// dates are replaced.
+func (db *Database) FillFromCsv(path string, ticker string) (*ImportReport, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	defer resp.Body.Close()
-	reader := csv.NewReader(resp.Body)
-	r, err := reader.ReadAll()
+	defer file.Close()
+	quotes, report, err := parsePriceCsv(file)
 	if err != nil {
-		return err
+		return report, fmt.Errorf("%s: %w", path, err)
+	}
+	replaced, err := db.insertQuotes(ticker, quotes)
+	if err != nil {
+		return report, err
+	}
+	report.Replaced += replaced
+	report.Inserted = len(quotes)
+	return report, nil
+}
+
+// Try each price source in order until one returns quotes for the ticker,
+// and store them in the price table. If since is nonzero, only quotes dated
+// on or after since are fetched, and finding none is not an error. Returns
+// ErrUnknownTicker if no source knows the ticker, ErrSourceUnavailable if
+// some source failed otherwise.
+func (db *Database) fillFromSources(ticker string, since time.Time) (error) {
+	if len(db.sources) == 0 {
+		return fmt.Errorf("%w: no price source configured for %s", ErrSourceUnavailable, ticker)
 	}
-	db.MustUpdate("BEGIN TRANSACTION");
-	for _, line := range r {
-		matches := dateRe.FindStringSubmatch(line[0])
-		if (matches == nil) {
-			continue;
+	var lastErr error
+	for _, source := range db.sources {
+		var quotes []PriceQuote
+		var err error
+		if incr, ok := source.(IncrementalPriceSource); ok && !since.IsZero() {
+			quotes, err = incr.FetchSince(ticker, since)
+		} else {
+			quotes, err = source.Fetch(ticker)
+			quotes = quotesSince(quotes, since)
 		}
-		date := time.Date(mustParseDecimal(matches[1]),
-			time.Month(mustParseDecimal(matches[2])),
-			mustParseDecimal(matches[3]),
-			0, 0, 0, 0, time.UTC)
-		sql := fmt.Sprintf("INSERT INTO price values('%s', %d, %f, %f, %f, %f, %d, %f)",
-			ticker,
-			date.Unix(),
-			mustParseFloat(line[1]),
-			mustParseFloat(line[2]),
-			mustParseFloat(line[3]),
-			mustParseFloat(line[4]),
-			mustParseDecimal(line[5]),
-			mustParseFloat(line[6]));
-		db.MustUpdate(sql)
-	}
-	db.MustUpdate("COMMIT TRANSACTION");
-	return nil
+		if err == nil && len(quotes) == 0 {
+			err = fmt.Errorf("%w: %s has no quotes for %s since %v",
+				ErrUnknownTicker, source.Name(), ticker, since)
+		}
+		if err != nil {
+			log.Print("Price source ", source.Name(), " failed for ", ticker, ": ", err)
+			if lastErr == nil || errors.Is(lastErr, ErrUnknownTicker) {
+				lastErr = err
+			}
+			continue
+		}
+		_, err = db.insertQuotes(ticker, quotes)
+		return err
+	}
+	if !since.IsZero() && errors.Is(lastErr, ErrUnknownTicker) {
+		// The ticker is known, just not updated since.
+		return nil
+	}
+	if !errors.Is(lastErr, ErrUnknownTicker) && !errors.Is(lastErr, ErrSourceUnavailable) {
+		lastErr = fmt.Errorf("%w: %v", ErrSourceUnavailable, lastErr)
+	}
+	return lastErr
 }
 
-func (db Database) TableExists(table string) (bool) {
-	found := false;
-	db.MustRunQuery(
-		fmt.Sprintf("SELECT name FROM sqlite_master WHERE type='table' AND name='%s'", table),
-		func(val... interface{}) {
-		if val[0] == table {
-			found = true
+// Store quotes in the price table, replacing existing rows for the same
+// dates. Returns the number of rows replaced, including rows that already
+// had the same values. If no quote is new or changed, nothing is written
+// and the stored correlations of the ticker are kept; otherwise they and
+// the cached stats of the ticker are dropped.
+func (db *Database) insertQuotes(ticker string, quotes []PriceQuote) (int, error) {
+	changed, err := db.changedQuotes(ticker, quotes)
+	if err != nil { return 0, err }
+	if len(changed) == 0 {
+		return len(quotes), nil
+	}
+	before, err := db.countPrices(ticker)
+	if err != nil { return 0, err }
+	err = db.inTransaction(func() error {
+		// Stored correlations are computed from the old prices.
+		err := db.Exec("DELETE FROM correlation WHERE ticker1 = ? OR ticker2 = ?", ticker, ticker)
+		if err != nil { return err }
+		for _, q := range changed {
+			// The unique price_index turns this into an upsert.
+			err := db.Exec("INSERT OR REPLACE INTO price VALUES(?, ?, ?, ?, ?, ?, ?, ?)",
+				ticker,
+				q.Date.Unix(),
+				q.Open,
+				q.High,
+				q.Low,
+				q.Close,
+				int64(q.Volume),
+				q.AdjClose)
+			if err != nil { return err }
 		}
+		return nil
 	})
-	return found
+	db.forget(ticker)
+	if err != nil { return 0, err }
+	after, err := db.countPrices(ticker)
+	if err != nil { return 0, err }
+	return len(quotes) - (after - before), nil
 }
 
-func (db Database) GetDateRange(ticker string) (*dateRange) {
+// The quotes that are not in the price table with the same values, e.g.,
+// all but the last stored quote when a refresh fetches from its date.
+func (db Database) changedQuotes(ticker string, quotes []PriceQuote) ([]PriceQuote, error) {
+	if len(quotes) == 0 {
+		return quotes, nil
+	}
+	oldest := quotes[0].Date.Unix()
+	for _, q := range quotes {
+		if q.Date.Unix() < oldest { oldest = q.Date.Unix() }
+	}
+	rows, err := db.Query(
+		"SELECT date, open, high, low, close, volume, adjclose FROM price WHERE ticker = ? AND date >= ?",
+		ticker, oldest)
+	if err != nil { return nil, err }
+	stored := make(map[int64]PriceQuote)
+	for _, row := range rows {
+		stored[row[0].(int64)] = PriceQuote{
+			Open: row[1].(float64),
+			High: row[2].(float64),
+			Low: row[3].(float64),
+			Close: row[4].(float64),
+			Volume: int(row[5].(int64)),
+			AdjClose: row[6].(float64),
+		}
+	}
+	changed := []PriceQuote{}
+	for _, q := range quotes {
+		old, found := stored[q.Date.Unix()]
+		if found && old.Open == q.Open && old.High == q.High && old.Low == q.Low &&
+			old.Close == q.Close && old.Volume == q.Volume && old.AdjClose == q.AdjClose {
+			continue
+		}
+		changed = append(changed, q)
+	}
+	return changed, nil
+}
+
+// Number of rows in the price table for the ticker.
+func (db Database) countPrices(ticker string) (int, error) {
+	rows, err := db.Query("SELECT COUNT(*) FROM price WHERE ticker = ?", ticker)
+	if err != nil { return 0, err }
+	return int(rows[0][0].(int64)), nil
+}
+
+func (db Database) TableExists(table string) (bool, error) {
+	rows, err := db.Query(
+		"SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table)
+	if err != nil { return false, err }
+	return len(rows) > 0, nil
+}
+
+func (db Database) GetDateRange(ticker string) (*dateRange, error) {
 	minDate := time.Now()
 	var maxDate time.Time
 	// maxDate is zero by default
-	db.MustRunQuery(
-		fmt.Sprintf("SELECT MIN(date), MAX(date) FROM price WHERE ticker='%s'", ticker),
-		func(val... interface{}) {
-		if val[0] == nil {
-			// No row found for the ticker
-		} else {
-			minDate = time.Unix(val[0].(int64), 0)
-			maxDate = time.Unix(val[1].(int64), 0)
-		}
-	})
-	return NewDateRange(minDate, maxDate, time.Hour * 24)
+	rows, err := db.Query(
+		"SELECT MIN(date), MAX(date) FROM price WHERE ticker = ?", ticker)
+	if err != nil { return nil, err }
+	if rows[0][0] == nil {
+		// No row found for the ticker
+	} else {
+		minDate = time.Unix(rows[0][0].(int64), 0)
+		maxDate = time.Unix(rows[0][1].(int64), 0)
+	}
+	return NewDateRange(minDate, maxDate, time.Hour * 24), nil
 }
 
-func (db Database) FillCorrelationIfNecessary(ticker1 string, ticker2 string) (error) {
-	return nil
+// Make sure the correlation between the tickers over r is stored in the
+// correlation table.
+func (db *Database) FillCorrelationIfNecessary(ticker1 string, ticker2 string, r *dateRange) (error) {
+	_, err := db.Correlation(ticker1, ticker2, r)
+	return err
 }
 
-func CreateDb(path string) (*Database) {
+// Open the database at path, creating it if necessary, and bring its schema
+// up to date. Missing or stale
+// tickers are fetched from sources, tried in order. If no source is given,
+// the database fetches from Yahoo.
+func CreateDb(path string, sources... PriceSource) (*Database, error) {
 	sqlite3.Initialize()
 	db, err := sqlite3.Open(path, sqlite3.O_CREATE | sqlite3.O_READWRITE);
 	if err != nil {
-		log.Panic("Failed to create db: ", path, ": ", err)
+		return nil, fmt.Errorf("Failed to create db %s: %v", path, err)
 	}
 
 	var d *Database = new(Database);
 	d.Path = path
 	d.db = db
-	d.cachedSecurities = make(map[string]*Security)
-	d.correlationCache = make(map[TickerPair]float64)
-	if !d.TableExists("dividend") {
-		d.MustUpdate("CREATE TABLE dividend (ticker VARCHAR(10), date INTEGER, dividend REAL)");
+	d.sources = sources
+	d.refresh = DefaultRefreshPolicy
+	d.ewmaHalfLife = DefaultEwmaHalfLife
+	d.varLevels = DefaultVaRConfidenceLevels()
+	if len(d.sources) == 0 {
+		d.sources = []PriceSource{NewYahooPriceSource("")}
 	}
-	if !d.TableExists("correlation") {
-		d.MustUpdate("CREATE TABLE correlation (ticker1 VARCHAR(10), ticker2 VARCHAR(10), corr REAL, lastUpdateDate INTEGER)");
-		d.MustUpdate("CREATE INDEX correlation_index ON correlation (ticker1, ticker2)")
-	}
-	if !d.TableExists("price") {
-		d.MustUpdate("CREATE TABLE price (ticker VARCHAR(10), date INTEGER, open REAL, high REAL, low REAL, close REAL, volume INTEGER, adjclose REAL)");
-		d.MustUpdate("CREATE INDEX price_index ON price (ticker, date)")
+	d.cachedSecurities = make(map[string]*Security)
+	d.statsCache = newLruCache(defaultCacheSize)
+	d.correlationCache = newLruCache(defaultCacheSize)
+	d.matrixCache = newLruCache(defaultCacheSize)
+	if err := d.migrate(); err != nil {
+		return nil, fmt.Errorf("Failed to migrate db %s: %v", path, err)
 	}
-	return d;
+	return d, nil
 }
 
 func ShutdownDb() {
@@ -14,6 +14,14 @@ type dateRange struct {
 	samplingInterval time.Duration
 }
 
+// Identifies a dateRange by value, for use as a map key. Two ranges with
+// the same key iterate over the same periods.
+type dateRangeKey struct {
+	start int64  // UNIX time
+	end int64
+	samplingInterval time.Duration
+}
+
 type dateRangeIterator struct {
 	r *dateRange
 	t time.Time
@@ -50,10 +58,24 @@ func (d *dateRange) String() string {
 	return fmt.Sprintf("[%v,%v,%v]", d.start, d.end, d.samplingInterval)
 }
 
+func (d *dateRange) Key() dateRangeKey {
+	return dateRangeKey{d.start.Unix(), d.end.Unix(), d.samplingInterval}
+}
+
+func (d1 *dateRange) Equal(d2 *dateRange) bool {
+	return d1.Key() == d2.Key()
+}
+
 func (d *dateRange) Empty() bool {
 	return d.start.After(d.end)
 }
 
+// Number of sampling periods in the range.
+func (d *dateRange) NumPeriods() int {
+	if d.Empty() { return 0 }
+	return int(d.end.Sub(d.start) / d.samplingInterval) + 1
+}
+
 func (d *dateRange) Start() (time.Time) { return d.start }
 func (d *dateRange) End() (time.Time) { return d.end }
 
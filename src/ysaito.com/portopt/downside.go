@@ -0,0 +1,88 @@
+package portopt
+
+import "math"
+import "time"
+
+// Risk measures that only count losses. They are computed from simple
+// returns regardless of the database's ReturnType.
+type DownsideRisk struct {
+	// Root mean square of the shortfall of the per-period returns below
+	// the minimum acceptable return. See SetMinimumAcceptableReturn.
+	DownsideDeviation float64
+
+	// Mean per-period return in excess of the minimum acceptable return,
+	// over DownsideDeviation. Zero if DownsideDeviation is zero.
+	Sortino float64
+
+	// The largest loss from a peak to a later trough, as a fraction of
+	// the peak value, e.g., 0.25 for a 25% fall.
+	MaxDrawdown float64
+
+	// Start times of the sampling periods of the peak and the trough of
+	// MaxDrawdown, and of the first period after the trough whose value
+	// is back at the peak. Recovery is zero if that never happened.
+	Peak time.Time
+	Trough time.Time
+	Recovery time.Time
+
+	// The compound annual growth rate over MaxDrawdown. Zero if there
+	// was no drawdown.
+	Calmar float64
+}
+
+// Set the annual return below which a return counts as a loss in
+// DownsideRisk. The default is 0. It's divided by the number of sampling
+// periods in a year to get the per-period threshold.
+func (db *Database) SetMinimumAcceptableReturn(annualReturn float64) {
+	db.minAcceptableReturn = annualReturn
+	db.statsCache.Clear()
+}
+
+func (db *Database) MinimumAcceptableReturn() float64 { return db.minAcceptableReturn }
+
+// Compute downside risk from the value of an investment at the start of
+// each period; values[k] is for the period that starts at dates[k]. mar is
+// the minimum acceptable annual return.
+func downsideRisk(dates []time.Time, values []float64, mar float64, periodsPerYear float64) DownsideRisk {
+	var risk DownsideRisk
+	if len(values) < 2 {
+		return risk
+	}
+	threshold := mar / periodsPerYear
+	n := float64(len(values) - 1)
+	total, shortfall2 := 0.0, 0.0
+	peak, trough := 0, 0
+	maxPeak := 0  // index of the highest value so far
+	for k := 1; k < len(values); k++ {
+		r := SimpleReturns.delta(values[k], values[k - 1])
+		total += r
+		if r < threshold {
+			shortfall2 += (r - threshold) * (r - threshold)
+		}
+		if values[k] > values[maxPeak] {
+			maxPeak = k
+		}
+		drawdown := 1 - values[k] / values[maxPeak]
+		if drawdown > risk.MaxDrawdown {
+			risk.MaxDrawdown = drawdown
+			peak, trough = maxPeak, k
+		}
+	}
+	risk.DownsideDeviation = math.Sqrt(shortfall2 / n)
+	if risk.DownsideDeviation > 0 {
+		risk.Sortino = (total / n - threshold) / risk.DownsideDeviation
+	}
+	if risk.MaxDrawdown > 0 {
+		risk.Peak = dates[peak]
+		risk.Trough = dates[trough]
+		for k := trough + 1; k < len(values); k++ {
+			if values[k] >= values[peak] {
+				risk.Recovery = dates[k]
+				break
+			}
+		}
+		cagr := math.Pow(values[len(values) - 1] / values[0], periodsPerYear / n) - 1
+		risk.Calmar = cagr / risk.MaxDrawdown
+	}
+	return risk
+}
@@ -0,0 +1,71 @@
+package portopt
+
+import "math"
+import "testing"
+import "time"
+
+func TestDownsideRisk(t *testing.T) {
+	values := []float64{100, 120, 90, 60, 100, 130, 110}
+	dates := make([]time.Time, len(values))
+	for k := range dates {
+		dates[k] = time.Date(2000, time.Month(k + 1), 1, 0, 0, 0, 0, time.UTC)
+	}
+	risk := downsideRisk(dates, values, 0, 12)
+	if risk.MaxDrawdown != 0.5 { t.Error(risk.MaxDrawdown) }
+	if !risk.Peak.Equal(dates[1]) || !risk.Trough.Equal(dates[3]) || !risk.Recovery.Equal(dates[5]) { t.Error(risk) }
+
+	losses := []float64{-0.25, -1.0 / 3, -20.0 / 130}
+	total2 := 0.0
+	for _, l := range losses {
+		total2 += l * l
+	}
+	if math.Abs(risk.DownsideDeviation - math.Sqrt(total2 / 6)) > 1e-12 { t.Error(risk.DownsideDeviation) }
+	cagr := math.Pow(1.1, 2) - 1
+	if math.Abs(risk.Calmar - cagr / 0.5) > 1e-12 { t.Error(risk.Calmar, cagr) }
+
+	// A higher minimum acceptable return counts more shortfall.
+	strict := downsideRisk(dates, values, 1.2, 12)
+	if strict.DownsideDeviation <= risk.DownsideDeviation || strict.Sortino >= risk.Sortino { t.Error(strict, risk) }
+
+	// Never recovered.
+	risk = downsideRisk(dates[:5], values[:5], 0, 12)
+	if !risk.Recovery.IsZero() || !risk.Trough.Equal(dates[3]) { t.Error(risk) }
+
+	// No drawdown at all.
+	risk = downsideRisk(dates[:2], values[:2], 0, 12)
+	if risk.MaxDrawdown != 0 || risk.Calmar != 0 || risk.Sortino != 0 || !risk.Peak.IsZero() { t.Error(risk) }
+}
+
+func TestStats_Downside(t *testing.T) {
+	values := []float64{100, 120, 90, 60, 100, 130, 110}
+	f := newStatsFixture(t, "A", map[string][]float64{"A": values})
+	dates := periodQuotes(values)
+	stats := f.stats
+	if stats.MaxDrawdown != 0.5 || !stats.Peak.Equal(dates[1].Date) || !stats.Trough.Equal(dates[3].Date) ||
+		!stats.Recovery.Equal(dates[5].Date) {
+		t.Error(stats.DownsideRisk)
+	}
+	losses := []float64{-0.25, -1.0 / 3, -20.0 / 130}
+	total2 := 0.0
+	for _, l := range losses {
+		total2 += l * l
+	}
+	if math.Abs(stats.DownsideDeviation - math.Sqrt(total2 / 6)) > 1e-12 { t.Error(stats.DownsideDeviation) }
+	cagr := math.Pow(1.1, allTime.PeriodsPerYear() / 6) - 1
+	if math.Abs(stats.Calmar - cagr / 0.5) > 1e-12 { t.Error(stats.Calmar, cagr) }
+	if math.Abs(f.pstats.Sortino - stats.Sortino) > 1e-12 || f.pstats.MaxDrawdown != 0.5 || !f.pstats.Trough.Equal(stats.Trough) {
+		t.Error(f.pstats.DownsideRisk, stats.DownsideRisk)
+	}
+
+	// A 10% annual minimum acceptable return moves the threshold of each
+	// period up from 0.
+	f.db.SetMinimumAcceptableReturn(0.1)
+	strict, err := f.db.Stats("A", allTime)
+	if err != nil { t.Fatal(err) }
+	threshold := 0.1 / allTime.PeriodsPerYear()
+	total2 = 0.0
+	for _, l := range losses {
+		total2 += (l - threshold) * (l - threshold)
+	}
+	if math.Abs(strict.DownsideDeviation - math.Sqrt(total2 / 6)) > 1e-12 { t.Error(strict.DownsideDeviation) }
+}
@@ -0,0 +1,25 @@
+package portopt
+
+import "errors"
+
+// Errors returned by Database methods and price sources. They are usually
+// wrapped with details, so test for them with errors.Is.
+var (
+	// No price source knows the ticker, and the database has no prices
+	// for it.
+	ErrUnknownTicker = errors.New("unknown ticker")
+
+	// The date ranges being compared have no period in common.
+	ErrNoOverlap = errors.New("date ranges do not overlap")
+
+	// A row or header of a price file could not be parsed.
+	ErrMalformedRow = errors.New("malformed row")
+
+	// A security has no quote for a sampling period and the missing data
+	// policy is FailOnMissing.
+	ErrMissingData = errors.New("missing price data")
+
+	// A price source could not be reached, or failed for a reason other
+	// than not knowing the ticker. Retrying later may help.
+	ErrSourceUnavailable = errors.New("price source unavailable")
+)
@@ -0,0 +1,57 @@
+package portopt
+
+import "fmt"
+import "math"
+import "time"
+
+// Default half-life of the exponentially weighted statistics.
+const DefaultEwmaHalfLife = time.Duration(time.Hour * 24 * 365 * 2)
+
+// Set the half-life of the exponentially weighted (EWMA) statistics:
+// SecurityStats.EwmaStddev, EwmaCorrelation and the EwmaCovariance
+// estimator. The return of a period that ended halfLife before the newest
+// one counts half as much as the newest. A non-positive halfLife weights
+// all periods equally, like the sample statistics.
+func (db *Database) SetEwmaHalfLife(halfLife time.Duration) {
+	db.ewmaHalfLife = halfLife
+	db.statsCache.Clear()
+	db.matrixCache.Clear()
+}
+
+func (db *Database) EwmaHalfLife() time.Duration { return db.ewmaHalfLife }
+
+// The factor by which the weight of a return decays per sampling period
+// of r.
+func (db *Database) ewmaDecay(r *dateRange) float64 {
+	if db.ewmaHalfLife <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(r.samplingInterval) / float64(db.ewmaHalfLife))
+}
+
+// Exponentially weighted correlation of the per-period returns of the two
+// tickers over the periods of r for which both have prices. Unlike
+// Correlation, the result is neither cached nor stored in the database.
+func (db *Database) EwmaCorrelation(ticker1 string, ticker2 string, r *dateRange) (float64, error) {
+	s1, err := db.FindSecurity(ticker1)
+	if err != nil { return -1.0, err }
+	s2, err := db.FindSecurity(ticker2)
+	if err != nil { return -1.0, err }
+
+	dateRange := s1.prices.DateRange().Intersect(s2.prices.DateRange()).Intersect(r)
+	if dateRange.Empty() {
+		return -1.0, fmt.Errorf("%w: %s %v, %s %v, requested %v",
+			ErrNoOverlap, ticker1, s1.prices.DateRange(), ticker2, s2.prices.DateRange(), r)
+	}
+	prices, err := alignPrices(dateRange, db.missingData, s1.prices, s2.prices)
+	if err != nil { return -1.0, err }
+	stats1 := db.newAccumulator(ticker1)
+	stats2 := db.newAccumulator(ticker2)
+	for i := range prices[0] {
+		stats1.Add(prices[0][i])
+		stats2.Add(prices[1][i])
+	}
+	decay := db.ewmaDecay(dateRange)
+	return ewmaCovariance(stats1, stats2, decay) /
+		stats1.EwmaStdDev(decay) / stats2.EwmaStdDev(decay), nil
+}
@@ -0,0 +1,65 @@
+package portopt
+
+import "math"
+import "testing"
+
+func TestEwmaCovariance(t *testing.T) {
+	calm := newStatsAccumulator("calm")
+	price := 100.0
+	for i := 0; i < 100; i++ {
+		calm.Add(price)
+		if i % 2 == 0 { price *= 1.01 } else { price *= 0.995 }
+	}
+	// The same history, except that the last few periods are volatile.
+	volatile := newStatsAccumulator("volatile")
+	price = 100.0
+	for i := 0; i < 100; i++ {
+		volatile.Add(price)
+		swing := 0.01
+		if i >= 90 { swing = 0.1 }
+		if i % 2 == 0 { price *= 1 + swing } else { price *= 1 - swing / 2 }
+	}
+
+	if math.Abs(ewmaCovariance(calm, volatile, 1) - covariance(calm, volatile)) > 1e-15 {
+		t.Error(ewmaCovariance(calm, volatile, 1), covariance(calm, volatile))
+	}
+	if math.Abs(volatile.EwmaStdDev(1) - volatile.StdDev()) > 1e-15 {
+		t.Error(volatile.EwmaStdDev(1), volatile.StdDev())
+	}
+	if volatile.EwmaStdDev(0.9) <= 2 * volatile.StdDev() {
+		t.Error(volatile.EwmaStdDev(0.9), volatile.StdDev())
+	}
+}
+
+func TestEwmaStats(t *testing.T) {
+	f := newStatsFixture(t, "A", map[string][]float64{
+		"A": compound(0.1, -0.1, 0.1),
+		"B": compound(0.02, -0.04, 0.05),
+	})
+	db := f.db
+	if db.EwmaHalfLife() != DefaultEwmaHalfLife { t.Error(db.EwmaHalfLife()) }
+
+	// A half-life of one period weighs the returns, newest first, by 1,
+	// 0.5 and 0.25.
+	db.SetEwmaHalfLife(minInterval)
+	meanA, meanB := 0.075 / 1.75, 0.035 / 1.75
+	varA := 0.0175 / 1.75 - meanA * meanA
+	varB := 0.0034 / 1.75 - meanB * meanB
+	cov := 0.0075 / 1.75 - meanA * meanB
+	stats, err := db.Stats("A", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(stats.EwmaStddev - math.Sqrt(varA)) > 1e-12 { t.Error(stats.EwmaStddev, math.Sqrt(varA)) }
+	corr, err := db.EwmaCorrelation("A", "B", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(corr - cov / math.Sqrt(varA * varB)) > 1e-12 { t.Error(corr, cov / math.Sqrt(varA * varB)) }
+
+	db.SetCovarianceEstimator(EwmaCovariance)
+	m, err := db.CovarianceMatrix([]string{"A", "B"}, allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(m.At(0, 1) - cov) > 1e-12 || math.Abs(m.At(1, 1) - varB) > 1e-12 { t.Error(m, cov, varB) }
+
+	db.SetEwmaHalfLife(0)
+	stats, err = db.Stats("A", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(stats.EwmaStddev - math.Sqrt(8.0 / 900)) > 1e-12 { t.Error(stats) }
+}
@@ -5,6 +5,7 @@
 package portopt
 import "bytes"
 import "fmt"
+import "math"
 import "github.com/yasushi-saito/rbtree"
 
 type frontierItem struct {
@@ -15,10 +16,14 @@ type frontierItem struct {
 
 type frontier struct {
 	tree *rbtree.Tree
+
+	// If nonzero, String reports x and y annualized. See Annualize.
+	periodsPerYear float64
 }
 
 type frontierIterator struct {
 	iter rbtree.Iterator
+	periodsPerYear float64
 }
 
 func (iter frontierIterator) Item() interface{} {
@@ -33,8 +38,21 @@ func (iter frontierIterator) Stddev() float64 {
 	return iter.iter.Item().(frontierItem).y
 }
 
+// Mean() times the number of periods in a year, if the frontier is
+// annualized; else Mean().
+func (iter frontierIterator) AnnualizedMean() float64 {
+	if iter.periodsPerYear == 0 { return iter.Mean() }
+	return iter.Mean() * iter.periodsPerYear
+}
+
+// Stddev() scaled to a year, if the frontier is annualized; else Stddev().
+func (iter frontierIterator) AnnualizedStddev() float64 {
+	if iter.periodsPerYear == 0 { return iter.Stddev() }
+	return iter.Stddev() * math.Sqrt(iter.periodsPerYear)
+}
+
 func (iter frontierIterator) Next() frontierIterator {
-	return frontierIterator{iter.iter.Next()}
+	return frontierIterator{iter.iter.Next(), iter.periodsPerYear}
 }
 
 func (iter frontierIterator) Done() bool {
@@ -87,7 +105,16 @@ func (f *frontier) MaxX() float64 {
 }
 
 func (f *frontier) Iterate() frontierIterator {
-	return frontierIterator{iter: f.tree.Min()}
+	return frontierIterator{iter: f.tree.Min(), periodsPerYear: f.periodsPerYear}
+}
+
+// Report the frontier in annualized units, assuming x is the mean and y the
+// standard deviation of returns over sampling periods of which there are
+// periodsPerYear in a year, e.g., PortfolioStats.PerPeriodReturn() and
+// Volatility(). Zero reports the values as inserted. Insert always takes
+// per-period values.
+func (f *frontier) Annualize(periodsPerYear float64) {
+	f.periodsPerYear = periodsPerYear
 }
 
 // Returns true if the entry was inserted (i.e., it is part of the
@@ -188,10 +215,39 @@ func (f *frontier) maybeRemoveRightElements(
 	}
 }
 
+// The capital market line: the line through (riskFree, 0) that touches the
+// frontier at the tangency item, which has the highest Sharpe ratio
+// (x - riskFree) / y. x and y must be the per-period mean and standard
+// deviation of returns, i.e., PortfolioStats.PerPeriodReturn and
+// Volatility, and riskFree the per-period risk-free return, e.g., from
+// Database.RiskFreeReturn. The line means nothing for a frontier of another
+// risk measure, such as Risk under ModifiedVaRRisk. Returns an iterator at
+// the tangency item and its Sharpe ratio, the slope of the line with y on
+// the horizontal axis. The iterator is Done if no item has a positive y.
+func (f *frontier) CapitalMarketLine(riskFree float64) (frontierIterator, float64) {
+	var tangency frontierIterator
+	found := false
+	bestSharpe := 0.0
+	iter := f.Iterate()
+	for ; !iter.Done(); iter = iter.Next() {
+		if iter.Stddev() <= 0 {
+			continue
+		}
+		sharpe := (iter.Mean() - riskFree) / iter.Stddev()
+		if !found || sharpe > bestSharpe {
+			tangency, bestSharpe, found = iter, sharpe, true
+		}
+	}
+	if !found {
+		return iter, 0
+	}
+	return tangency, bestSharpe
+}
+
 func (f *frontier) String() string {
 	buf := bytes.NewBufferString("")
 	for iter := f.Iterate(); !iter.Done(); iter = iter.Next() {
-		fmt.Fprint(buf, "P: mean=", iter.Mean(), " stddev=", iter.Stddev(),
+		fmt.Fprint(buf, "P: mean=", iter.AnnualizedMean(), " stddev=", iter.AnnualizedStddev(),
 			" port=", iter.Item(), "\n")
 	}
 	return buf.String()
@@ -4,6 +4,7 @@
 package portopt
 
 import "testing"
+import "math"
 import "math/rand"
 
 func testAssert(t *testing.T, b bool, messages... interface{}) {
@@ -62,3 +63,27 @@ func TestFrontier_Randomized(t *testing.T) {
 		}
 	}
 }
+
+func TestFrontier_Annualize(t *testing.T) {
+	f := newFrontier()
+	f.Insert(0.01, 0.02, nil)
+	iter := f.Iterate()
+	testAssert(t, iter.AnnualizedMean() == 0.01 && iter.AnnualizedStddev() == 0.02, "Raw")
+	f.Annualize(4)
+	iter = f.Iterate()
+	testAssert(t, iter.AnnualizedMean() == 0.04 && iter.AnnualizedStddev() == 0.04, "Annualized")
+	testAssert(t, iter.Mean() == 0.01 && iter.Stddev() == 0.02, "Mean")
+}
+
+func TestFrontier_CapitalMarketLine(t *testing.T) {
+	f := newFrontier()
+	iter, sharpe := f.CapitalMarketLine(0.01)
+	testAssert(t, iter.Done() && sharpe == 0, "Empty")
+
+	f.Insert(0.02, 0.05, "a")  // sharpe 0.2
+	f.Insert(0.04, 0.1, "b")  // sharpe 0.3
+	f.Insert(0.06, 0.2, "c")  // sharpe 0.25
+	iter, sharpe = f.CapitalMarketLine(0.01)
+	testAssert(t, !iter.Done() && iter.Item() == "b", "Tangency ", iter.Item())
+	testAssert(t, math.Abs(sharpe - 0.3) < 1e-12, "Sharpe ", sharpe)
+}
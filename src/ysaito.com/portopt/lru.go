@@ -0,0 +1,97 @@
+package portopt
+
+import "container/list"
+
+// Hit and miss counts of a cache.
+type CacheCounters struct {
+	Hits int64
+	Misses int64
+	Evictions int64
+
+	// Number of entries currently in the cache.
+	Entries int
+}
+
+// A map that holds at most maxEntries entries, evicting the least
+// recently used one when full. Keys must be comparable.
+type lruCache struct {
+	maxEntries int
+	order *list.List  // of *lruEntry, most recently used first
+	entries map[interface{}]*list.Element
+	counters CacheCounters
+}
+
+type lruEntry struct {
+	key interface{}
+	value interface{}
+}
+
+func newLruCache(maxEntries int) *lruCache {
+	doAssert(maxEntries > 0, "maxEntries=", maxEntries)
+	return &lruCache{
+		maxEntries: maxEntries,
+		order: list.New(),
+		entries: make(map[interface{}]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key interface{}) (interface{}, bool) {
+	e, found := c.entries[key]
+	if !found {
+		c.counters.Misses++
+		return nil, false
+	}
+	c.counters.Hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lruCache) Put(key interface{}, value interface{}) {
+	if e, found := c.entries[key]; found {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.counters.Evictions++
+	}
+}
+
+// Remove every entry whose key satisfies pred.
+func (c *lruCache) RemoveIf(pred func(key interface{}) bool) {
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		if pred(e.Value.(*lruEntry).key) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *lruCache) Clear() {
+	c.order.Init()
+	c.entries = make(map[interface{}]*list.Element)
+}
+
+// Change the capacity, evicting entries if it shrinks.
+func (c *lruCache) Resize(maxEntries int) {
+	doAssert(maxEntries > 0, "maxEntries=", maxEntries)
+	c.maxEntries = maxEntries
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.counters.Evictions++
+	}
+}
+
+func (c *lruCache) Counters() CacheCounters {
+	counters := c.counters
+	counters.Entries = c.order.Len()
+	return counters
+}
+
+func (c *lruCache) remove(e *list.Element) {
+	delete(c.entries, e.Value.(*lruEntry).key)
+	c.order.Remove(e)
+}
@@ -0,0 +1,54 @@
+package portopt
+
+import "reflect"
+import "testing"
+import "time"
+
+func TestLru_Evict(t *testing.T) {
+	c := newLruCache(2)
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if v, found := c.Get("a"); !found || v.(int) != 1 { t.Error(v, found) }
+
+	// "b" is now the least recently used.
+	c.Put("c", 3)
+	if _, found := c.Get("b"); found { t.Error("b not evicted") }
+	if _, found := c.Get("a"); !found { t.Error("a evicted") }
+
+	counters := c.Counters()
+	if counters.Hits != 2 || counters.Misses != 1 || counters.Evictions != 1 || counters.Entries != 2 {
+		t.Error(counters)
+	}
+
+	c.RemoveIf(func(key interface{}) bool { return key.(string) == "a" })
+	if _, found := c.Get("a"); found { t.Error("a not removed") }
+	c.Resize(1)
+	if c.Counters().Entries != 1 { t.Error(c.Counters()) }
+}
+
+func TestStats_CacheByValue(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+
+	newRange := func() *dateRange {
+		return NewDateRange(
+			time.Date(1990, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2000, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+			minInterval)
+	}
+	stats1, err := db.Stats("C", newRange())
+	if err != nil { t.Fatal(err) }
+	stats2, err := db.Stats("C", newRange())
+	if err != nil { t.Fatal(err) }
+	if !reflect.DeepEqual(stats1, stats2) { t.Error(stats1, stats2) }
+	counters := db.StatsCacheCounters()
+	if counters.Hits != 1 || counters.Misses != 1 { t.Error(counters) }
+
+	db.SetCacheSize(1)
+	_, err = db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	counters = db.StatsCacheCounters()
+	if counters.Entries != 1 || counters.Evictions != 1 { t.Error(counters) }
+}
@@ -0,0 +1,62 @@
+package portopt
+
+import "bytes"
+import "fmt"
+
+// A dense square matrix whose rows and columns are labeled by tickers.
+type Matrix struct {
+	tickers []string
+	values []float64  // row-major
+}
+
+func newMatrix(tickers []string) *Matrix {
+	n := len(tickers)
+	m := &Matrix{
+		tickers: make([]string, n),
+		values: make([]float64, n * n),
+	}
+	copy(m.tickers, tickers)
+	return m
+}
+
+// Number of rows (and columns).
+func (m *Matrix) N() int { return len(m.tickers) }
+
+// The label of the i'th row and column.
+func (m *Matrix) Ticker(i int) string { return m.tickers[i] }
+
+// The row and column index of the ticker, or -1 if absent.
+func (m *Matrix) Index(ticker string) int {
+	for i, t := range m.tickers {
+		if t == ticker { return i }
+	}
+	return -1
+}
+
+func (m *Matrix) At(i, j int) float64 { return m.values[i * m.N() + j] }
+
+func (m *Matrix) set(i, j int, v float64) { m.values[i * m.N() + j] = v }
+
+// Computes w' M w.
+func (m *Matrix) QuadraticForm(w []float64) float64 {
+	doAssert(len(w) == m.N(), "len(w)=", len(w), " n=", m.N())
+	total := 0.0
+	for i := range w {
+		for j := range w {
+			total += w[i] * w[j] * m.At(i, j)
+		}
+	}
+	return total
+}
+
+func (m *Matrix) String() string {
+	buf := bytes.NewBufferString("")
+	for i := 0; i < m.N(); i++ {
+		fmt.Fprintf(buf, "%-8s", m.tickers[i])
+		for j := 0; j < m.N(); j++ {
+			fmt.Fprintf(buf, " %12.6g", m.At(i, j))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
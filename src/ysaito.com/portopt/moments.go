@@ -0,0 +1,61 @@
+package portopt
+
+import "math"
+
+// Shape of the distribution of the simple per-period returns, for
+// detecting fat tails that the mean and stddev hide.
+type HigherMoments struct {
+	// Negative if large losses are more likely than large gains.
+	Skewness float64
+
+	// Kurtosis minus 3, i.e., 0 for normally distributed returns.
+	// Positive values mean fat tails.
+	Kurtosis float64
+
+	// The Jarque-Bera statistic, n/6 * (Skewness^2 + Kurtosis^2/4).
+	// Large values reject normality.
+	JarqueBera float64
+
+	// The probability of a JarqueBera at least this large if the returns
+	// were normally distributed (chi-squared with two degrees of
+	// freedom).
+	JarqueBeraPValue float64
+}
+
+// Mean, standard deviation, skewness and excess kurtosis of the returns,
+// all population moments.
+func moments(returns []float64) (mean, stddev, skewness, kurtosis float64) {
+	n := float64(len(returns))
+	if n == 0 {
+		return 0, 0, 0, 0
+	}
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= n
+	m2, m3, m4 := 0.0, 0.0, 0.0
+	for _, r := range returns {
+		d := r - mean
+		m2 += d * d
+		m3 += d * d * d
+		m4 += d * d * d * d
+	}
+	m2 /= n
+	m3 /= n
+	m4 /= n
+	if m2 == 0 {
+		return mean, 0, 0, 0
+	}
+	return mean, math.Sqrt(m2), m3 / math.Pow(m2, 1.5), m4 / (m2 * m2) - 3
+}
+
+func higherMoments(returns []float64) HigherMoments {
+	_, _, skewness, kurtosis := moments(returns)
+	jb := float64(len(returns)) / 6 * (skewness * skewness + kurtosis * kurtosis / 4)
+	return HigherMoments{
+		Skewness: skewness,
+		Kurtosis: kurtosis,
+		JarqueBera: jb,
+		JarqueBeraPValue: math.Exp(-jb / 2),
+	}
+}
@@ -0,0 +1,56 @@
+package portopt
+
+import "errors"
+import "math"
+import "testing"
+
+func TestHigherMoments(t *testing.T) {
+	m := higherMoments([]float64{1, 2, 3, 4})
+	if m.Skewness != 0 || math.Abs(m.Kurtosis + 1.36) > 1e-12 { t.Error(m) }
+	jb := 4.0 / 6 * 1.36 * 1.36 / 4
+	if math.Abs(m.JarqueBera - jb) > 1e-12 || math.Abs(m.JarqueBeraPValue - math.Exp(-jb / 2)) > 1e-12 { t.Error(m) }
+
+	// One crash among small gains.
+	returns := make([]float64, 50)
+	for i := range returns {
+		returns[i] = 0.01
+	}
+	returns[17] = -0.3
+	m = higherMoments(returns)
+	if m.Skewness >= -1 || m.Kurtosis <= 1 || m.JarqueBeraPValue >= 0.01 { t.Error(m) }
+}
+
+func TestPortfolio_Risk(t *testing.T) {
+	// Deviations from the mean of 1/30 are 1/15, -2/15 and 1/15.
+	prices := compound(0.1, -0.1, 0.1)
+	f := newStatsFixture(t, "A", map[string][]float64{"A": prices})
+	skewness, kurtosis := -1 / math.Sqrt2, -1.5
+	for _, m := range []HigherMoments{f.stats.HigherMoments, f.pstats.HigherMoments} {
+		if math.Abs(m.Skewness - skewness) > 1e-9 || math.Abs(m.Kurtosis - kurtosis) > 1e-9 { t.Error(m) }
+	}
+	sd := math.Sqrt(8.0 / 900)
+	if math.Abs(f.pstats.Risk() - sd) > 1e-12 || f.pstats.Risk() != f.pstats.Volatility() { t.Error(f.pstats.Risk(), sd) }
+
+	db := f.db
+	db.SetRiskMeasure(ModifiedVaRRisk)
+	p := NewPortfolio(db, allTime, map[string]float64{"A": 1.0})
+	pstats, err := p.Stats()
+	if err != nil { t.Fatal(err) }
+	want := -(1.0 / 30 + cornishFisherQuantile(1 - ModifiedRiskConfidence, skewness, kurtosis) * sd)
+	if math.Abs(pstats.Risk() - want) > 1e-9 { t.Error(pstats.Risk(), want) }
+
+	// A single period has no return to take the VaR of.
+	start := periodQuotes(prices)[0].Date
+	p = NewPortfolio(db, NewDateRange(start, start, minInterval), map[string]float64{"A": 1.0})
+	if _, err := p.Stats(); !errors.Is(err, ErrNoOverlap) { t.Error(err) }
+}
+
+func TestPortfolio_StatsCachedWhenNegative(t *testing.T) {
+	f := newStatsFixture(t, "A", map[string][]float64{"A": compound(-0.1, -0.2)})
+	if math.Abs(f.pstats.PerPeriodReturn() + 0.15) > 1e-12 { t.Error(f.pstats) }
+	// Stats computed once are kept, as SetRiskMeasure documents.
+	f.db.SetRiskMeasure(ModifiedVaRRisk)
+	pstats, err := f.portfolio.Stats()
+	if err != nil { t.Fatal(err) }
+	if pstats.Risk() != f.pstats.Risk() { t.Error(pstats.Risk(), f.pstats.Risk()) }
+}
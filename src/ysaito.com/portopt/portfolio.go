@@ -4,6 +4,7 @@
 //
 
 package portopt
+import "fmt"
 import "math"
 import "math/rand"
 
@@ -14,7 +15,42 @@ type portfolioEntry struct {
 
 type PortfolioStats struct {
 	perPeriodReturn float64
-	stddev float64
+	variance float64  // variance of the per-period returns
+	periodsPerYear float64  // sampling periods in a year
+	risk float64  // see Risk
+
+	// Of the portfolio rebalanced to its weights every sampling period.
+	DownsideRisk
+	VaR []ValueAtRisk
+	HigherMoments
+	ExcessReturns
+}
+
+// The risk of the portfolio as measured by the database's RiskMeasure when
+// the stats were computed. Rank portfolios by Risk to build a frontier for
+// a risk measure other than the stddev.
+func (s PortfolioStats) Risk() float64 { return s.risk }
+
+func (s PortfolioStats) PerPeriodReturn() float64 { return s.perPeriodReturn }
+
+// Standard deviation of the per-period returns.
+func (s PortfolioStats) Volatility() float64 { return math.Sqrt(s.variance) }
+
+// The per-period return times the number of periods in a year. Unlike the
+// per-period figures, annualized ones don't depend on the sampling
+// interval of the portfolio's date range.
+func (s PortfolioStats) AnnualizedReturn() float64 {
+	return s.perPeriodReturn * s.periodsPerYear
+}
+
+// The volatility, scaled to a year assuming independent returns.
+func (s PortfolioStats) AnnualizedVolatility() float64 {
+	return math.Sqrt(s.variance * s.periodsPerYear)
+}
+
+// Sharpe scaled to a year, assuming independent returns.
+func (s PortfolioStats) AnnualizedSharpe() float64 {
+	return s.Sharpe * math.Sqrt(s.periodsPerYear)
 }
 
 type Portfolio struct {
@@ -23,6 +59,7 @@ type Portfolio struct {
 	totalWeight float64
 	dateRange *dateRange
 	cachedStats PortfolioStats
+	haveStats bool  // true once cachedStats is computed
 }
 
 func NewPortfolio(db *Database,
@@ -32,8 +69,6 @@ func NewPortfolio(db *Database,
 	p.db = db
 	p.securities = make([]portfolioEntry, len(securities))
 	p.dateRange = dateRange
-	p.cachedStats.perPeriodReturn = -1.0  // sentinel
-	p.cachedStats.stddev = -1.0
 	n := 0
 	for s, w := range securities {
 		p.securities[n].ticker = s
@@ -44,39 +79,80 @@ func NewPortfolio(db *Database,
 	return p
 }
 
-func (p *Portfolio) Stats() PortfolioStats {
-	if p.cachedStats.perPeriodReturn < 0.0 {
-		variance := 0.0
+// Compute the return and risk of the portfolio over its date range. All
+// the statistics come from the periods in which every security has a
+// price; periods without quotes are treated according to the database's
+// MissingDataPolicy, and covariances are estimated by its
+// CovarianceEstimator.
+func (p *Portfolio) Stats() (PortfolioStats, error) {
+	if !p.haveStats {
+		// Build the stats aside, so that an error doesn't leave them
+		// half-computed in the cache.
+		var stats PortfolioStats
+		tickers, weights := p.normalizedWeights()
+		js, err := p.Db().jointStats(tickers, p.DateRange())
+		if err != nil { return p.cachedStats, err }
+
 		perPeriodReturn := 0.0
-		arithMean := 0.0
-		db := p.Db()
-		for _, e1 := range p.List() {
-			w1 := e1.weight / p.TotalWeight()
-			stats1, err := db.Stats(e1.ticker, p.DateRange())
-			if err != nil { panic(err) }
-
-			perPeriodReturn += w1 * stats1.PerPeriodReturn
-			arithMean += w1 * stats1.ArithmeticMean
-
-			for _, e2 := range p.List() {
-				corr, err := db.Correlation(e1.ticker, e2.ticker)
-				if err != nil { panic(err) }
-				w2 := e2.weight / p.TotalWeight()
-				stats2, err := db.Stats(e2.ticker, p.DateRange())
-				if err != nil { panic(err) }
-				variance += w1 * w2 * corr * stats1.Stddev * stats2.Stddev
+		for i, w := range weights {
+			perPeriodReturn += w * js.means[i]
+		}
+		stats.perPeriodReturn = perPeriodReturn
+		stats.variance = math.Max(0, js.covariance.QuadraticForm(weights))
+		stats.periodsPerYear = js.dateRange.PeriodsPerYear()
+
+		values := rebalancedValues(js, weights)
+		stats.DownsideRisk = downsideRisk(js.dates, values,
+			p.Db().MinimumAcceptableReturn(), stats.periodsPerYear)
+		returns := periodReturns(values)
+		stats.VaR = valueAtRisk(returns, p.Db().varLevels)
+		stats.HigherMoments = higherMoments(returns)
+		riskFree, err := p.Db().riskFreeReturns(js.dates)
+		if err != nil { return p.cachedStats, err }
+		stats.ExcessReturns = excessReturns(returns, riskFree)
+		switch p.Db().RiskMeasure() {
+		case ModifiedVaRRisk:
+			if len(returns) == 0 {
+				return p.cachedStats, fmt.Errorf("%w: portfolio has no returns in %v to compute %v",
+					ErrNoOverlap, js.dateRange, ModifiedVaRRisk)
 			}
+			stats.risk = valueAtRisk(returns, []float64{ModifiedRiskConfidence})[0].CornishFisher
+		default:
+			stats.risk = stats.Volatility()
+		}
+		p.cachedStats = stats
+		p.haveStats = true
+	}
+	return p.cachedStats, nil
+}
+
+// The tickers of the portfolio and their weights, scaled to add up to 1.
+func (p *Portfolio) normalizedWeights() ([]string, []float64) {
+	tickers := make([]string, len(p.securities))
+	weights := make([]float64, len(p.securities))
+	for i, e := range p.List() {
+		tickers[i] = e.ticker
+		weights[i] = e.weight / p.TotalWeight()
+	}
+	return tickers, weights
+}
+
+// Value at the start of each period of js.dates of 1 invested in the first
+// len(weights) securities of js, rebalanced to the weights every period.
+func rebalancedValues(js *jointStats, weights []float64) []float64 {
+	values := make([]float64, len(js.dates))
+	for k := range values {
+		if k == 0 {
+			values[k] = 1
+			continue
 		}
-		var stddev float64
-		if (variance <= 0) {
-			stddev = 0
-		} else {
-			stddev = math.Sqrt(variance) / arithMean
+		r := 0.0
+		for i, w := range weights {
+			r += w * SimpleReturns.delta(js.prices[i][k], js.prices[i][k - 1])
 		}
-		p.cachedStats.perPeriodReturn = perPeriodReturn
-		p.cachedStats.stddev = stddev
+		values[k] = values[k - 1] * (1 + r)
 	}
-	return p.cachedStats
+	return values
 }
 
 func (p *Portfolio) RandomMutate() (*Portfolio) {
@@ -86,7 +162,6 @@ func (p *Portfolio) RandomMutate() (*Portfolio) {
 		securities: make([]portfolioEntry, n),
 	        totalWeight: 0.0, // filled later
 		dateRange: p.dateRange,
-	        cachedStats: PortfolioStats{-1.0, -1.0},
 	}
 	for i, e := range p.securities {
 		q.securities[i] = e
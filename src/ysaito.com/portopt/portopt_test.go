@@ -1,6 +1,8 @@
 package portopt;
 
+import "errors"
 import "log"
+import "math"
 import "os"
 import "fmt"
 import "testing"
@@ -8,36 +10,109 @@ import "time"
 import "github.com/yasushi-saito/fifo_queue"
 var pathSeq int = 0;
 
-func newDb(t *testing.T) (db *Database) {
+func newDb(t *testing.T, sources... PriceSource) (db *Database) {
 	err := os.MkdirAll("/tmp/portopt_test", 0700)
 	if err != nil { t.Fatal(err) }
 
 	pathSeq += 1
 	path := fmt.Sprintf("/tmp/portopt_test/db%d.db", pathSeq)
 	os.Remove(path)  // ignore error
-	return CreateDb(path)
+	db, err = CreateDb(path, sources...)
+	if err != nil { t.Fatal(err) }
+	return db
+}
+
+// A date range covering every price in the tests.
+var allTime = NewDateRange(
+	time.Date(1970, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+	time.Now(),
+	minInterval)
+
+// Prices starting at 100 that move by the given per-period simple returns.
+func compound(returns... float64) []float64 {
+	prices := []float64{100}
+	for _, r := range returns {
+		prices = append(prices, prices[len(prices) - 1] * (1 + r))
+	}
+	return prices
+}
+
+// One quote per sampling period of allTime, starting in 2000, so that
+// stats over allTime see exactly the given prices.
+func periodQuotes(prices []float64) []PriceQuote {
+	secs := int64(minInterval / time.Second)
+	first := time.Date(2000, time.Month(1), 1, 0, 0, 0, 0, time.UTC).Unix() / secs
+	quotes := make([]PriceQuote, len(prices))
+	for k, p := range prices {
+		quotes[k] = PriceQuote{
+			Date: time.Unix((first + int64(k)) * secs, 0).UTC(),
+			Open: p, High: p, Low: p, Close: p,
+			AdjClose: p,
+		}
+	}
+	return quotes
+}
+
+// The common setup of the stats tests: a database with the prices of each
+// ticker, one per sampling period of allTime, and the stats of ticker and
+// of a portfolio holding only ticker over allTime.
+type statsFixture struct {
+	db *Database
+	stats SecurityStats
+	portfolio *Portfolio
+	pstats PortfolioStats
+}
+
+func newStatsFixture(t *testing.T, ticker string, prices map[string][]float64) *statsFixture {
+	quotes := make(map[string][]PriceQuote)
+	for name, values := range prices {
+		quotes[name] = periodQuotes(values)
+	}
+	f := &statsFixture{db: newDb(t, &fakePriceSource{name: "fixture", quotes: quotes})}
+	f.db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	var err error
+	f.stats, err = f.db.Stats(ticker, allTime)
+	if err != nil { t.Fatal(err) }
+	f.portfolio = NewPortfolio(f.db, allTime, map[string]float64{ticker: 1.0})
+	f.pstats, err = f.portfolio.Stats()
+	if err != nil { t.Fatal(err) }
+	return f
 }
 
 func TestCreate(t *testing.T) {
 	db := newDb(t)
-	err := db.FillFromCsv("C.bak", "C")
+	_, err := db.FillFromCsv("C.bak", "C")
 	if err != nil { t.Fatal(err) }
 
-	r := db.GetDateRange("FOOBAR")
+	r, err := db.GetDateRange("FOOBAR")
+	if err != nil { t.Fatal(err) }
 	log.Print("FOO range: [", r.Start(), "..", r.End(), "]")
 	if !r.Empty()  { t.Error("Range: ", r.Start(), r.End()) }
 }
 
 func TestSecurity(t *testing.T) {
 	db := newDb(t)
-	err := db.FillFromCsv("C.bak", "C")
+	_, err := db.FillFromCsv("C.bak", "C")
 	if err != nil { t.Fatal(err) }
 
-	corr, err := db.Correlation("C", "C")
+	corr, err := db.Correlation("C", "C", allTime)
 	if err != nil { t.Fail() }
 	if corr < 0.99 || corr >= 1.01 { t.Fatal(corr) }
 }
 
+func TestStats_NoOverlap(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+
+	r := NewDateRange(
+		time.Date(1950, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1960, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+		time.Duration(time.Hour * 24 * 30))
+	_, err = db.Stats("C", r)
+	if !errors.Is(err, ErrNoOverlap) { t.Error(err) }
+}
+
 func TestDateRange(t *testing.T) {
 	d := NewDateRange(
 		time.Date(1980, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
@@ -54,14 +129,15 @@ func TestCorrelation(t *testing.T) {
 	if err != nil { t.Fatal(err) }
 
 	path := "/tmp/portopt_test/corr.db"
-	db := CreateDb(path)
+	db, err := CreateDb(path)
+	if err != nil { t.Fatal(err) }
 
-	corr, err := db.Correlation("C", "C")
+	corr, err := db.Correlation("C", "C", allTime)
 	fmt.Print("CORR1=", corr, err, "\n")
-	corr, err = db.Correlation("C", "GOOG")
+	corr, err = db.Correlation("C", "GOOG", allTime)
 	log.Print("CORR2=", corr, err, "\n")
 
-	corr, err = db.Correlation("VBMFX", "VGTSX")
+	corr, err = db.Correlation("VBMFX", "VGTSX", allTime)
 	log.Print("CORR3=", corr, err, "\n")
 }
 
@@ -70,7 +146,8 @@ func TestEff(t *testing.T) {
 	if err != nil { t.Fatal(err) }
 
 	path := "/tmp/portopt_test/eff.db"
-	db := CreateDb(path)
+	db, err := CreateDb(path)
+	if err != nil { t.Fatal(err) }
 
 	dateRange := NewDateRange(time.Date(1980, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
 		time.Now(),
@@ -111,7 +188,8 @@ func TestEff(t *testing.T) {
 
 	for fifo.Len() > 0 {
 		p := fifo.PopFront().(*Portfolio)
-		stats := p.Stats()
+		stats, err := p.Stats()
+		if err != nil { t.Fatal(err) }
 		maxTries := 20
 		if stats.perPeriodReturn >= frontier.MaxX() {
 			// Try many times to find a better return
@@ -123,9 +201,10 @@ func TestEff(t *testing.T) {
 
 		for i := 0; i < maxTries; i++ {
 			newP := p.RandomMutate()
-			stats := newP.Stats()
+			stats, err := newP.Stats()
+			if err != nil { t.Fatal(err) }
 			maxX := frontier.MaxX()
-			inserted := frontier.Insert(stats.perPeriodReturn, stats.stddev, newP)
+			inserted := frontier.Insert(stats.perPeriodReturn, stats.Volatility(), newP)
 			if inserted {
 				fifo.PushBack(newP)
 				if stats.perPeriodReturn > maxX {
@@ -141,6 +220,190 @@ func TestEff(t *testing.T) {
 		}
 	}
 
+	frontier.Annualize(dateRange.PeriodsPerYear())
 	fmt.Print(frontier.String())
+
+	riskFree, err := db.RiskFreeReturn(dateRange)
+	if err != nil { t.Fatal(err) }
+	tangency, sharpe := frontier.CapitalMarketLine(riskFree)
+	if !tangency.Done() {
+		fmt.Print("Tangency: mean=", tangency.AnnualizedMean(), " stddev=", tangency.AnnualizedStddev(),
+			" sharpe=", sharpe * math.Sqrt(dateRange.PeriodsPerYear()), " port=", tangency.Item(), "\n")
+	}
+}
+
+// Turn the database back into one with schema version 1.
+func downgradeToV1(t *testing.T, db *Database) {
+	err := db.execAll(
+		"DELETE FROM schema_version WHERE version >= 2",
+		"DROP INDEX price_index",
+		"CREATE INDEX price_index ON price (ticker, date)",
+		"DROP TABLE correlation",
+		"CREATE TABLE correlation (ticker1 VARCHAR(10), ticker2 VARCHAR(10), corr REAL, lastUpdateDate INTEGER)",
+		"CREATE INDEX correlation_index ON correlation (ticker1, ticker2)",
+		"DROP TABLE riskfree")
+	if err != nil { t.Fatal(err) }
 }
 
+func TestMigration_Dedupe(t *testing.T) {
+	db := newDb(t)
+	path := db.Path
+
+	// Simulate a database created before price_index was unique.
+	downgradeToV1(t, db)
+	var err error
+	for i := 0; i < 3; i++ {
+		err = db.Exec("INSERT INTO price VALUES('FOO', 1000, 1, 1, 1, 1, 1, ?)", i)
+		if err != nil { t.Fatal(err) }
+	}
+	err = db.Exec("INSERT INTO price VALUES('FOO', 2000, 1, 1, 1, 1, 1, 1)")
+	if err != nil { t.Fatal(err) }
+
+	db, err = CreateDb(path)
+	if err != nil { t.Fatal(err) }
+	if n, _ := db.countPrices("FOO"); n != 2 { t.Fatal(n) }
+	rows, err := db.Query("SELECT adjclose FROM price WHERE ticker = 'FOO' AND date = 1000")
+	if err != nil { t.Fatal(err) }
+	if rows[0][0].(float64) != 2 { t.Error(rows) }
+	if v, _ := db.SchemaVersion(); v != LatestSchemaVersion() { t.Error(v) }
+	_, err = db.FillFromCsv("C.bak", "FOO")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "FOO")
+	if err != nil { t.Fatal(err) }
+	if n, _ := db.countPrices("FOO"); n != 8937 + 2 { t.Error(n) }
+}
+
+func TestMigration_Status(t *testing.T) {
+	db := newDb(t)
+	version, pending, err := SchemaStatus(db.Path)
+	if err != nil { t.Fatal(err) }
+	if version != LatestSchemaVersion() || len(pending) != 0 { t.Error(version, pending) }
+
+	downgradeToV1(t, db)
+	version, pending, err = SchemaStatus(db.Path)
+	if err != nil { t.Fatal(err) }
+	if version != 1 || len(pending) != len(migrations) - 1 || pending[0].Version != 2 {
+		t.Error(version, pending)
+	}
+
+	// A missing database is an error, not created.
+	missing := db.Path + ".missing"
+	if _, _, err := SchemaStatus(missing); err == nil { t.Error("No error for ", missing) }
+	if _, err := os.Stat(missing); !os.IsNotExist(err) { t.Error(missing, " created: ", err) }
+}
+
+func TestQuotedTicker(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "BRK'B")
+	if err != nil { t.Fatal(err) }
+	if r, _ := db.GetDateRange("BRK'B"); r.Empty() { t.Error("BRK'B not stored") }
+	if r, _ := db.GetDateRange("BRK"); !r.Empty() { t.Error("BRK stored") }
+	if n, _ := db.countPrices("BRK'B"); n != 8937 { t.Error(n) }
+}
+
+func TestFindSecurity_Gap(t *testing.T) {
+	quotes := monthlyQuotes(36)
+	// Drop six months in the middle of the history.
+	quotes = append(quotes[:12], quotes[18:]...)
+	db := newDb(t, &fakePriceSource{
+		name: "gap",
+		quotes: map[string][]PriceQuote{"FOO": quotes},
+	})
+	s, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if n := s.Prices().NumPrices(); n < 28 { t.Error("History truncated: ", n) }
+	last := quotes[len(quotes) - 1].Date
+	if s.Prices().DateRange().End().Before(last.Add(-minInterval)) {
+		t.Error("History truncated at ", s.Prices().DateRange().End())
+	}
+	if len(s.Prices().Gaps()) < 4 { t.Error("Gaps: ", s.Prices().Gaps()) }
+}
+
+func TestCorrelation_Persisted(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	corr, err := db.Correlation("C", "D", allTime)
+	if err != nil { t.Fatal(err) }
+
+	// Plant a different value to check that a new Database reads the
+	// table instead of recomputing.
+	err = db.Exec("UPDATE correlation SET corr = 0.5 WHERE ticker1 = 'C' AND ticker2 = 'D'")
+	if err != nil { t.Fatal(err) }
+	db2, err := CreateDb(db.Path)
+	if err != nil { t.Fatal(err) }
+	db2.SetRefreshPolicy(RefreshPolicy{Never: true})
+	if c, _ := db2.Correlation("D", "C", allTime); c != 0.5 { t.Error(c) }
+
+	// Re-importing the same prices keeps the row, and changing the prices
+	// of either ticker invalidates it. The new quote predates C, so the
+	// recomputed correlation is the same.
+	_, err = db2.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+	rows, err := db2.Query("SELECT corr FROM correlation")
+	if err != nil { t.Fatal(err) }
+	if len(rows) != 1 || rows[0][0].(float64) != 0.5 { t.Error(rows) }
+	_, err = db2.insertQuotes("D", []PriceQuote{{Date: time.Date(1971, time.Month(1), 1, 0, 0, 0, 0, time.UTC), AdjClose: 1}})
+	if err != nil { t.Fatal(err) }
+	db3, err := CreateDb(db.Path)
+	if err != nil { t.Fatal(err) }
+	db3.SetRefreshPolicy(RefreshPolicy{Never: true})
+	if c, _ := db3.Correlation("C", "D", allTime); c != corr { t.Error(c, corr) }
+}
+
+func TestCorrelation_Flat(t *testing.T) {
+	quotes := monthlyQuotes(24)
+	flat := monthlyQuotes(24)
+	for i := range flat {
+		flat[i].AdjClose = 1
+	}
+	db := newDb(t, &fakePriceSource{name: "fake", quotes: map[string][]PriceQuote{"FOO": quotes, "MM": flat}})
+	corr, err := db.Correlation("MM", "FOO", allTime)
+	if err != nil { t.Fatal(err) }
+	if corr != 0 { t.Error(corr) }
+
+	// A NULL left by an older version is recomputed.
+	err = db.Exec("UPDATE correlation SET corr = NULL")
+	if err != nil { t.Fatal(err) }
+	db2, err := CreateDb(db.Path)
+	if err != nil { t.Fatal(err) }
+	db2.SetRefreshPolicy(RefreshPolicy{Never: true})
+	corr, err = db2.Correlation("MM", "FOO", allTime)
+	if err != nil { t.Fatal(err) }
+	if corr != 0 { t.Error(corr) }
+}
+
+func TestCorrelation_DateRange(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	err = db.Exec("UPDATE price SET adjclose = adjclose * 2 WHERE ticker = 'D' AND date < ?",
+		time.Date(2000, time.Month(1), 1, 0, 0, 0, 0, time.UTC).Unix())
+	if err != nil { t.Fatal(err) }
+
+	// D differs from C only before 2000, and only in the period when
+	// prices double.
+	since2000 := NewDateRange(
+		time.Date(2000, time.Month(3), 1, 0, 0, 0, 0, time.UTC),
+		time.Now(),
+		minInterval)
+	corr, err := db.Correlation("C", "D", since2000)
+	if err != nil { t.Fatal(err) }
+	if corr < 0.99 || corr >= 1.01 { t.Error(corr) }
+	corr, err = db.Correlation("C", "D", allTime)
+	if err != nil { t.Fatal(err) }
+	if corr >= 0.99 { t.Error(corr) }
+
+	before1950 := NewDateRange(
+		time.Date(1940, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1950, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+		minInterval)
+	_, err = db.Correlation("C", "D", before1950)
+	if !errors.Is(err, ErrNoOverlap) { t.Error(err) }
+}
@@ -0,0 +1,197 @@
+package portopt
+
+import "encoding/csv"
+import "fmt"
+import "io"
+import "math"
+import "strconv"
+import "strings"
+import "time"
+
+// Columns of a Yahoo-format price CSV file.
+const (
+	csvDate = iota
+	csvOpen
+	csvHigh
+	csvLow
+	csvClose
+	csvVolume
+	csvAdjClose
+	numCsvColumns
+)
+
+// Header name (lowercased, with spaces and underscores removed) -> column.
+var csvColumnNames = map[string]int{
+	"date": csvDate,
+	"open": csvOpen,
+	"high": csvHigh,
+	"low": csvLow,
+	"close": csvClose,
+	"volume": csvVolume,
+	"adjclose": csvAdjClose,
+	"adjustedclose": csvAdjClose,
+}
+
+// A CSV row that was not imported.
+type SkippedRow struct {
+	Line int  // 1-based line number in the file
+	Reason string
+}
+
+// Summary of FillFromCsv.
+type ImportReport struct {
+	// Number of rows stored in the price table.
+	Inserted int
+
+	// Number of rows whose date was already in the price table, or
+	// appeared earlier in the same file. The later row wins.
+	Replaced int
+
+	Skipped []SkippedRow
+}
+
+func (r *ImportReport) String() string {
+	return fmt.Sprintf("inserted=%d replaced=%d skipped=%d",
+		r.Inserted, r.Replaced, len(r.Skipped))
+}
+
+// Maps the header row to column indexes. Result[csvX] is the index of
+// column X in each row, or -1 if the column is missing. Date and either
+// Close or Adj Close are mandatory.
+func parseCsvHeader(header []string) ([]int, error) {
+	columns := make([]int, numCsvColumns)
+	for i := range columns {
+		columns[i] = -1
+	}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		key = strings.Replace(key, " ", "", -1)
+		key = strings.Replace(key, "_", "", -1)
+		col, found := csvColumnNames[key]
+		if !found {
+			continue
+		}
+		if columns[col] >= 0 {
+			return nil, fmt.Errorf("%w: duplicate column %q in CSV header", ErrMalformedRow, name)
+		}
+		columns[col] = i
+	}
+	if columns[csvDate] < 0 {
+		return nil, fmt.Errorf("%w: CSV header has no Date column: %v", ErrMalformedRow, header)
+	}
+	if columns[csvClose] < 0 && columns[csvAdjClose] < 0 {
+		return nil, fmt.Errorf("%w: CSV header has neither Close nor Adj Close column: %v", ErrMalformedRow, header)
+	}
+	return columns, nil
+}
+
+// Parse one CSV row. Prices must be finite and positive. Missing
+// Open/High/Low columns default to Close, a missing Close defaults to Adj
+// Close and vice versa.
+func parseCsvRow(columns []int, row []string) (PriceQuote, error) {
+	var q PriceQuote
+	field := func(col int) string {
+		if columns[col] < 0 { return "" }
+		return strings.TrimSpace(row[columns[col]])
+	}
+	for _, i := range columns {
+		if i >= len(row) {
+			return q, fmt.Errorf("%w: expect at least %d fields, found %d", ErrMalformedRow, i + 1, len(row))
+		}
+	}
+
+	matches := dateRe.FindStringSubmatch(field(csvDate))
+	if matches == nil {
+		return q, fmt.Errorf("%w: bad date %q", ErrMalformedRow, field(csvDate))
+	}
+	year, _ := strconv.Atoi(matches[1])
+	month, _ := strconv.Atoi(matches[2])
+	day, _ := strconv.Atoi(matches[3])
+	q.Date = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+
+	prices := []struct {
+		col int
+		value *float64
+	}{
+		{csvOpen, &q.Open},
+		{csvHigh, &q.High},
+		{csvLow, &q.Low},
+		{csvClose, &q.Close},
+		{csvAdjClose, &q.AdjClose},
+	}
+	for _, p := range prices {
+		if columns[p.col] < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(field(p.col), 64)
+		// Also reject prices that would make returns infinite or
+		// that the database can't store.
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) || v <= 0 {
+			return q, fmt.Errorf("%w: bad price %q", ErrMalformedRow, field(p.col))
+		}
+		*p.value = v
+	}
+	if columns[csvVolume] >= 0 {
+		v, err := strconv.ParseFloat(field(csvVolume), 64)
+		if err != nil {
+			return q, fmt.Errorf("%w: bad volume %q", ErrMalformedRow, field(csvVolume))
+		}
+		q.Volume = int(v)
+	}
+
+	if columns[csvClose] < 0 { q.Close = q.AdjClose }
+	if columns[csvAdjClose] < 0 { q.AdjClose = q.Close }
+	if columns[csvOpen] < 0 { q.Open = q.Close }
+	if columns[csvHigh] < 0 { q.High = q.Close }
+	if columns[csvLow] < 0 { q.Low = q.Close }
+	return q, nil
+}
+
+// Parse a price CSV stream whose first row is a header, e.g.,
+// "Date,Open,High,Low,Close,Volume,Adj Close". Columns may appear in any
+// order. Rows that can't be parsed are reported in report.Skipped. Errors
+// in the header or in the CSV syntax itself wrap ErrMalformedRow. If a
+// date appears more than once, the last row wins and report.Replaced is
+// incremented.
+func parsePriceCsv(in io.Reader) (quotes []PriceQuote, report *ImportReport, err error) {
+	report = new(ImportReport)
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, report, fmt.Errorf("%w: empty CSV file", ErrMalformedRow)
+	}
+	if err != nil {
+		return nil, report, fmt.Errorf("%w: %v", ErrMalformedRow, err)
+	}
+	columns, err := parseCsvHeader(header)
+	if err != nil {
+		return nil, report, err
+	}
+
+	// Date (UNIX time) -> index in quotes
+	seen := make(map[int64]int)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, report, fmt.Errorf("%w: %v", ErrMalformedRow, err)
+		}
+		line, _ := reader.FieldPos(0)
+		q, err := parseCsvRow(columns, row)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedRow{Line: line, Reason: err.Error()})
+			continue
+		}
+		if i, found := seen[q.Date.Unix()]; found {
+			quotes[i] = q
+			report.Replaced++
+			continue
+		}
+		seen[q.Date.Unix()] = len(quotes)
+		quotes = append(quotes, q)
+	}
+	return quotes, report, nil
+}
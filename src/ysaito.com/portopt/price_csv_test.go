@@ -0,0 +1,108 @@
+package portopt
+
+import "errors"
+import "io/ioutil"
+import "math"
+import "strings"
+import "testing"
+
+func TestPriceCsv_Header(t *testing.T) {
+	quotes, report, err := parsePriceCsv(strings.NewReader(
+		"Adj Close,Date,Volume\n" +
+		"10.5,2012-06-01,100\n" +
+		"11.0,2012-06-02,200\n"))
+	if err != nil { t.Fatal(err) }
+	if len(quotes) != 2 || len(report.Skipped) != 0 { t.Fatal(quotes, report) }
+	q := quotes[1]
+	if q.AdjClose != 11.0 || q.Close != 11.0 || q.Open != 11.0 || q.Volume != 200 {
+		t.Error(q)
+	}
+	if q.Date.Day() != 2 { t.Error(q.Date) }
+
+	_, _, err = parsePriceCsv(strings.NewReader("Date,Volume\n2012-06-01,100\n"))
+	if !errors.Is(err, ErrMalformedRow) { t.Error(err) }
+}
+
+func TestPriceCsv_SkipAndReplace(t *testing.T) {
+	quotes, report, err := parsePriceCsv(strings.NewReader(
+		"Date,Close\n" +
+		"2012-06-01,10\n" +
+		"junk,11\n" +
+		"2012-06-02,abc\n" +
+		"2012-06-01,12\n"))
+	if err != nil { t.Fatal(err) }
+	if len(quotes) != 1 || quotes[0].Close != 12 { t.Fatal(quotes) }
+	if report.Replaced != 1 { t.Error(report) }
+	if len(report.Skipped) != 2 || report.Skipped[0].Line != 3 || report.Skipped[1].Line != 4 {
+		t.Error(report.Skipped)
+	}
+}
+
+func TestPriceCsv_BadPrices(t *testing.T) {
+	quotes, report, err := parsePriceCsv(strings.NewReader(
+		"Date,Close,Adj Close\n" +
+		"2012-06-01,10,NaN\n" +
+		"2012-06-02,Inf,10\n" +
+		"2012-06-03,10,0\n" +
+		"2012-06-04,-1,10\n" +
+		"2012-06-05,10,10\n"))
+	if err != nil { t.Fatal(err) }
+	if len(quotes) != 1 || quotes[0].AdjClose != 10 { t.Fatal(quotes) }
+	if len(report.Skipped) != 4 { t.Fatal(report.Skipped) }
+	for i, row := range report.Skipped {
+		if row.Line != i + 2 || !strings.Contains(row.Reason, ErrMalformedRow.Error()) { t.Error(row) }
+	}
+}
+
+func TestFillFromCsv_Ticker(t *testing.T) {
+	db := newDb(t)
+	path := "/tmp/portopt_test/foo.csv"
+	err := ioutil.WriteFile(path, []byte(
+		"Date,Close\n2012-06-01,10\n2012-06-04,11\n"), 0600)
+	if err != nil { t.Fatal(err) }
+
+	report, err := db.FillFromCsv(path, "FOO")
+	if err != nil { t.Fatal(err) }
+	if report.Inserted != 2 || report.Replaced != 0 { t.Error(report) }
+	if r, _ := db.GetDateRange("FOO"); r.Empty() { t.Error("FOO not stored") }
+	if r, _ := db.GetDateRange("C"); !r.Empty() { t.Error("Rows stored as C") }
+
+	// Importing the same file again replaces every row.
+	report, err = db.FillFromCsv(path, "FOO")
+	if err != nil { t.Fatal(err) }
+	if report.Inserted != 2 || report.Replaced != 2 { t.Error(report) }
+}
+
+func TestFillFromCsv_DropsCachedStats(t *testing.T) {
+	db := newDb(t)
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	write := func(path string, csv string) {
+		err := ioutil.WriteFile(path, []byte("Date,Close\n" + csv), 0600)
+		if err != nil { t.Fatal(err) }
+	}
+	write("/tmp/portopt_test/foo.csv", "2012-01-02,10\n2012-02-01,11\n2012-03-01,12\n2012-04-02,11\n")
+	write("/tmp/portopt_test/bar.csv", "2012-01-02,10\n2012-02-01,10.5\n2012-03-01,12\n2012-04-02,12\n")
+	_, err := db.FillFromCsv("/tmp/portopt_test/foo.csv", "FOO")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("/tmp/portopt_test/bar.csv", "BAR")
+	if err != nil { t.Fatal(err) }
+	stats, err := db.Stats("FOO", allTime)
+	if err != nil { t.Fatal(err) }
+	corr, err := db.Correlation("FOO", "BAR", allTime)
+	if err != nil { t.Fatal(err) }
+	cov, err := db.CovarianceMatrix([]string{"FOO", "BAR"}, allTime)
+	if err != nil { t.Fatal(err) }
+
+	write("/tmp/portopt_test/foo.csv", "2012-04-02,9\n")
+	_, err = db.FillFromCsv("/tmp/portopt_test/foo.csv", "FOO")
+	if err != nil { t.Fatal(err) }
+	stats2, err := db.Stats("FOO", allTime)
+	if err != nil { t.Fatal(err) }
+	corr2, err := db.Correlation("FOO", "BAR", allTime)
+	if err != nil { t.Fatal(err) }
+	cov2, err := db.CovarianceMatrix([]string{"FOO", "BAR"}, allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(stats2.TotalReturn + 0.1) > 1e-12 { t.Error(stats2.TotalReturn, stats.TotalReturn) }
+	if corr2 == corr { t.Error(corr2) }
+	if cov2.At(0, 0) == cov.At(0, 0) { t.Error(cov2) }
+}
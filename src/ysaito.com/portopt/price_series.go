@@ -0,0 +1,174 @@
+package portopt
+
+import "fmt"
+import "time"
+
+// What to do about a sampling period in which a security has no quote.
+type MissingDataPolicy int
+
+const (
+	// Ignore the period, for every security being compared.
+	DropMissing MissingDataPolicy = iota
+
+	// Use the last quote before the period.
+	ForwardFill
+
+	// Interpolate linearly between the quotes before and after the
+	// period.
+	Interpolate
+
+	// Return ErrMissingData.
+	FailOnMissing
+)
+
+func (p MissingDataPolicy) String() string {
+	switch p {
+	case DropMissing: return "drop"
+	case ForwardFill: return "forward-fill"
+	case Interpolate: return "interpolate"
+	case FailOnMissing: return "fail"
+	}
+	return fmt.Sprintf("MissingDataPolicy(%d)", int(p))
+}
+
+// Adjusted closing prices of a security, one per sampling period. Periods
+// without a quote are recorded as gaps rather than dropped.
+type PriceSeries struct {
+	Ticker string
+
+	// The periods covered. The first and last period always have a
+	// quote.
+	dateRange *dateRange
+
+	prices []float64  // prices[i] is for the i'th period of dateRange
+	present []bool  // present[i] is false if the i'th period is a gap
+}
+
+func newPriceSeries(ticker string, r *dateRange) *PriceSeries {
+	n := r.NumPeriods()
+	return &PriceSeries{
+		Ticker: ticker,
+		dateRange: r,
+		prices: make([]float64, n),
+		present: make([]bool, n),
+	}
+}
+
+func (s *PriceSeries) DateRange() *dateRange { return s.dateRange }
+
+// Index of the period that starts at t, or -1 if t is out of range or
+// not at a period boundary.
+func (s *PriceSeries) index(t time.Time) int {
+	d := t.Sub(s.dateRange.Start())
+	if d < 0 || d % s.dateRange.samplingInterval != 0 {
+		return -1
+	}
+	i := int(d / s.dateRange.samplingInterval)
+	if i >= len(s.prices) {
+		return -1
+	}
+	return i
+}
+
+func (s *PriceSeries) set(i int, price float64) {
+	s.prices[i] = price
+	s.present[i] = true
+}
+
+// The quote for the period that starts at t. Returns false if the period
+// is a gap or outside the series.
+func (s *PriceSeries) Price(t time.Time) (float64, bool) {
+	i := s.index(t)
+	if i < 0 || !s.present[i] {
+		return 0, false
+	}
+	return s.prices[i], true
+}
+
+// Number of periods with a quote.
+func (s *PriceSeries) NumPrices() int {
+	n := 0
+	for _, p := range s.present {
+		if p { n++ }
+	}
+	return n
+}
+
+// Start times of the periods that have no quote.
+func (s *PriceSeries) Gaps() []time.Time {
+	gaps := []time.Time{}
+	for i, p := range s.present {
+		if !p {
+			gaps = append(gaps, s.periodStart(i))
+		}
+	}
+	return gaps
+}
+
+func (s *PriceSeries) periodStart(i int) time.Time {
+	return s.dateRange.Start().Add(time.Duration(i) * s.dateRange.samplingInterval)
+}
+
+// The price for the period that starts at t, filling a gap according to
+// policy. Returns false if the period should be dropped.
+func (s *PriceSeries) fill(t time.Time, policy MissingDataPolicy) (float64, bool, error) {
+	i := s.index(t)
+	if i < 0 {
+		return 0, false, nil
+	}
+	if s.present[i] {
+		return s.prices[i], true, nil
+	}
+	prev := i - 1
+	for prev >= 0 && !s.present[prev] { prev-- }
+	next := i + 1
+	for next < len(s.present) && !s.present[next] { next++ }
+
+	switch policy {
+	case ForwardFill:
+		if prev >= 0 {
+			return s.prices[prev], true, nil
+		}
+	case Interpolate:
+		if prev >= 0 && next < len(s.present) {
+			w := float64(i - prev) / float64(next - prev)
+			return s.prices[prev] + w * (s.prices[next] - s.prices[prev]), true, nil
+		}
+	case FailOnMissing:
+		return 0, false, fmt.Errorf("%w: %s has no quote for the period starting %v",
+			ErrMissingData, s.Ticker, t)
+	}
+	return 0, false, nil
+}
+
+// Sample the series over the periods of r, filling gaps according to
+// policy. Result[k][j] is the price of series[k] for the j'th period kept.
+// A period is dropped for all series if any of them can't supply a price
+// for it, so the result rows are aligned.
+func alignPrices(r *dateRange, policy MissingDataPolicy, series... *PriceSeries) ([][]float64, error) {
+	_, aligned, err := alignPricesWithDates(r, policy, series...)
+	return aligned, err
+}
+
+// Like alignPrices, but also returns the start time of each period kept.
+func alignPricesWithDates(r *dateRange, policy MissingDataPolicy, series... *PriceSeries) ([]time.Time, [][]float64, error) {
+	dates := []time.Time{}
+	aligned := make([][]float64, len(series))
+	row := make([]float64, len(series))
+	for iter := r.Begin(); !iter.Done(); iter.Next() {
+		keep := true
+		for k, s := range series {
+			price, ok, err := s.fill(iter.Time(), policy)
+			if err != nil { return nil, nil, err }
+			row[k] = price
+			keep = keep && ok
+		}
+		if keep {
+			dates = append(dates, iter.Time())
+			for k := range series {
+				aligned[k] = append(aligned[k], row[k])
+			}
+		}
+	}
+	return dates, aligned, nil
+}
@@ -0,0 +1,84 @@
+package portopt
+
+import "errors"
+import "testing"
+import "time"
+
+// Series with six monthly periods, of which the third and fourth are gaps.
+func newGappySeries() *PriceSeries {
+	start := time.Date(2000, time.Month(1), 1, 0, 0, 0, 0, time.UTC)
+	r := NewDateRange(start, start.Add(5 * minInterval), minInterval)
+	s := newPriceSeries("FOO", r)
+	s.set(0, 10.0)
+	s.set(1, 11.0)
+	s.set(4, 14.0)
+	s.set(5, 15.0)
+	return s
+}
+
+func floatsEqual(a, b []float64) bool {
+	if len(a) != len(b) { return false }
+	for i := range a {
+		if a[i] - b[i] > 1e-9 || b[i] - a[i] > 1e-9 { return false }
+	}
+	return true
+}
+
+func TestPriceSeries_Gaps(t *testing.T) {
+	s := newGappySeries()
+	gaps := s.Gaps()
+	if len(gaps) != 2 || !gaps[0].Equal(s.periodStart(2)) { t.Error(gaps) }
+	if s.NumPrices() != 4 { t.Error(s.NumPrices()) }
+	if _, ok := s.Price(s.periodStart(3)); ok { t.Error("Gap has a price") }
+	if p, ok := s.Price(s.periodStart(4)); !ok || p != 14.0 { t.Error(p, ok) }
+}
+
+func TestPriceSeries_Policies(t *testing.T) {
+	s := newGappySeries()
+	expected := map[MissingDataPolicy][]float64{
+		DropMissing: {10, 11, 14, 15},
+		ForwardFill: {10, 11, 11, 11, 14, 15},
+		Interpolate: {10, 11, 12, 13, 14, 15},
+	}
+	for policy, e := range expected {
+		prices, err := alignPrices(s.DateRange(), policy, s)
+		if err != nil { t.Fatal(policy, err) }
+		if !floatsEqual(prices[0], e) { t.Error(policy, prices[0]) }
+	}
+
+	_, err := alignPrices(s.DateRange(), FailOnMissing, s)
+	if !errors.Is(err, ErrMissingData) { t.Error(err) }
+}
+
+func TestPriceSeries_AlignDrop(t *testing.T) {
+	s1 := newGappySeries()
+	s2 := newPriceSeries("BAR", s1.DateRange())
+	for i := 0; i < 6; i++ {
+		if i != 1 { s2.set(i, float64(20 + i)) }
+	}
+	prices, err := alignPrices(s1.DateRange(), DropMissing, s1, s2)
+	if err != nil { t.Fatal(err) }
+	if !floatsEqual(prices[0], []float64{10, 14, 15}) { t.Error(prices[0]) }
+	if !floatsEqual(prices[1], []float64{20, 24, 25}) { t.Error(prices[1]) }
+}
+
+func TestStats_MissingDataPolicy(t *testing.T) {
+	quotes := monthlyQuotes(36)
+	quotes = append(quotes[:12], quotes[18:]...)
+	db := newDb(t, &fakePriceSource{
+		name: "gap",
+		quotes: map[string][]PriceQuote{"FOO": quotes},
+	})
+	s, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	r := s.Prices().DateRange()
+
+	db.SetMissingDataPolicy(FailOnMissing)
+	_, err = db.Stats("FOO", r)
+	if !errors.Is(err, ErrMissingData) { t.Error(err) }
+
+	db.SetMissingDataPolicy(Interpolate)
+	stats, err := db.Stats("FOO", r)
+	if err != nil { t.Fatal(err) }
+	if stats.PerPeriodReturn <= 0 { t.Error(stats) }
+}
@@ -0,0 +1,223 @@
+package portopt
+
+import "fmt"
+import "io"
+import "log"
+import "net/http"
+import "net/url"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+import "time"
+
+// One daily quote, as found in a row of a Yahoo-format CSV file.
+type PriceQuote struct {
+	Date time.Time
+	Open float64
+	High float64
+	Low float64
+	Close float64
+	Volume int
+	AdjClose float64
+}
+
+// A PriceSource supplies the daily price history of a ticker. FindSecurity
+// asks each source of the Database in turn until one of them returns quotes.
+type PriceSource interface {
+	// Short name used in log messages, e.g., "yahoo".
+	Name() string
+
+	// Fetch the price history of the ticker. Quotes may come in any
+	// order.
+	Fetch(ticker string) ([]PriceQuote, error)
+}
+
+// Implemented by price sources that can fetch just the recent part of a
+// history. The Database uses it to refresh stale tickers; for other
+// sources it fetches the whole history and discards the old quotes.
+type IncrementalPriceSource interface {
+	PriceSource
+
+	// Fetch the quotes dated on or after since.
+	FetchSince(ticker string, since time.Time) ([]PriceQuote, error)
+}
+
+// Drop quotes dated before since.
+func quotesSince(quotes []PriceQuote, since time.Time) []PriceQuote {
+	recent := make([]PriceQuote, 0, len(quotes))
+	for _, q := range quotes {
+		if !q.Date.Before(since) {
+			recent = append(recent, q)
+		}
+	}
+	return recent
+}
+
+// Creates a PriceSource from the argument part of a "name:arg" spec. arg
+// is "" if the spec has no colon.
+type PriceSourceFactory func(arg string) (PriceSource, error)
+
+var priceSourceFactories = make(map[string]PriceSourceFactory)
+
+// Register a factory so that NewPriceSource can create sources of the given
+// name. Registering the same name twice panics.
+func RegisterPriceSource(name string, factory PriceSourceFactory) {
+	_, found := priceSourceFactories[name]
+	doAssert(!found, "Price source registered twice: ", name)
+	priceSourceFactories[name] = factory
+}
+
+// Create a price source from a spec of form "name" or "name:arg", where name
+// is a name passed to RegisterPriceSource. For example,
+// "yahoo:http://mirror.example.com/table.csv?s=%s".
+func NewPriceSource(spec string) (PriceSource, error) {
+	name, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, arg = spec[:i], spec[i+1:]
+	}
+	factory, found := priceSourceFactories[name]
+	if !found {
+		return nil, fmt.Errorf("Unknown price source: %s", spec)
+	}
+	return factory(arg)
+}
+
+// Create a chain of price sources, one per spec. See NewPriceSource.
+func NewPriceSources(specs... string) ([]PriceSource, error) {
+	sources := make([]PriceSource, 0, len(specs))
+	for _, spec := range specs {
+		s, err := NewPriceSource(spec)
+		if err != nil { return nil, err }
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// Parse a Yahoo-format CSV stream. Rows that can't be parsed are logged
+// and dropped.
+func readYahooCsv(in io.Reader, label string) ([]PriceQuote, error) {
+	quotes, report, err := parsePriceCsv(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	if len(report.Skipped) > 0 {
+		log.Print(label, ": skipped ", len(report.Skipped), " rows, first: ",
+			report.Skipped[0].Line, ": ", report.Skipped[0].Reason)
+	}
+	return quotes, nil
+}
+
+// Yahoo's query parameters: a, b, c are the month (0-based), day and year
+// of the first quote; d, e, f those of the last.
+const defaultYahooUrl = "http://ichart.finance.yahoo.com/table.csv?s=%s&a=%02d&b=%d&c=%d&d=%02d&e=%d&f=%d&g=d&ignore=.csv"
+
+// The date of the oldest quote fetched from Yahoo.
+var yahooEpoch = time.Date(1980, time.Month(1), 1, 0, 0, 0, 0, time.UTC)
+
+// Fetches Yahoo-format CSV files over HTTP. urlFormat must contain one "%s",
+// which is replaced by the ticker. If urlFormat is empty, the source asks
+// Yahoo for just the dates it needs.
+type yahooPriceSource struct {
+	urlFormat string
+}
+
+func NewYahooPriceSource(urlFormat string) (PriceSource) {
+	return &yahooPriceSource{urlFormat: urlFormat}
+}
+
+func (s *yahooPriceSource) Name() string { return "yahoo" }
+
+func (s *yahooPriceSource) Fetch(ticker string) ([]PriceQuote, error) {
+	return s.FetchSince(ticker, yahooEpoch)
+}
+
+func (s *yahooPriceSource) FetchSince(ticker string, since time.Time) ([]PriceQuote, error) {
+	escaped := url.QueryEscape(ticker)
+	if s.urlFormat != "" {
+		quotes, err := s.get(ticker, fmt.Sprintf(s.urlFormat, escaped))
+		if err != nil { return nil, err }
+		return quotesSince(quotes, since), nil
+	}
+	now := time.Now()
+	return s.get(ticker, fmt.Sprintf(defaultYahooUrl, escaped,
+		int(since.Month()) - 1, since.Day(), since.Year(),
+		int(now.Month()) - 1, now.Day(), now.Year()))
+}
+
+func (s *yahooPriceSource) get(ticker string, url string) ([]PriceQuote, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSourceUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s: %s", ErrUnknownTicker, ticker, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: failed to fetch %s: %s", ErrSourceUnavailable, ticker, resp.Status)
+	}
+	return readYahooCsv(resp.Body, ticker)
+}
+
+// Reads Yahoo-format CSV files from a local directory, one file per ticker,
+// named <dir>/<TICKER>.csv.
+type CsvDirPriceSource struct {
+	Dir string
+}
+
+func NewCsvDirPriceSource(dir string) (*CsvDirPriceSource) {
+	return &CsvDirPriceSource{Dir: dir}
+}
+
+func (s *CsvDirPriceSource) Name() string { return "csvdir" }
+
+// The file of the ticker. Tickers that could name a file outside Dir are
+// unknown.
+func (s *CsvDirPriceSource) path(ticker string) (string, error) {
+	if strings.ContainsAny(ticker, `/\`) || strings.Contains(ticker, "..") {
+		return "", fmt.Errorf("%w: %q", ErrUnknownTicker, ticker)
+	}
+	return filepath.Join(s.Dir, ticker + ".csv"), nil
+}
+
+func (s *CsvDirPriceSource) Fetch(ticker string) ([]PriceQuote, error) {
+	path, err := s.path(ticker)
+	if err != nil { return nil, err }
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownTicker, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSourceUnavailable, err)
+	}
+	defer file.Close()
+	return readYahooCsv(file, path)
+}
+
+// List the tickers for which the directory has a CSV file, in sorted order.
+func (s *CsvDirPriceSource) Tickers() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	tickers := make([]string, 0, len(paths))
+	for _, path := range paths {
+		base := filepath.Base(path)
+		tickers = append(tickers, base[:len(base) - len(".csv")])
+	}
+	sort.Strings(tickers)
+	return tickers, nil
+}
+
+func init() {
+	RegisterPriceSource("yahoo", func(arg string) (PriceSource, error) {
+		return NewYahooPriceSource(arg), nil
+	})
+	RegisterPriceSource("csvdir", func(arg string) (PriceSource, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("csvdir: directory not specified")
+		}
+		return NewCsvDirPriceSource(arg), nil
+	})
+}
@@ -0,0 +1,120 @@
+package portopt
+
+import "errors"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+type fakePriceSource struct {
+	name string
+	quotes map[string][]PriceQuote
+	numFetches int
+}
+
+func (s *fakePriceSource) Name() string { return s.name }
+
+func (s *fakePriceSource) Fetch(ticker string) ([]PriceQuote, error) {
+	s.numFetches++
+	q, found := s.quotes[ticker]
+	if !found { return nil, fmt.Errorf("%w: %s", ErrUnknownTicker, ticker) }
+	return q, nil
+}
+
+// Generate monthly quotes for the last n months, with the price growing by
+// 1% each month.
+func monthlyQuotes(n int) []PriceQuote {
+	quotes := make([]PriceQuote, n)
+	price := 10.0
+	start := time.Now().AddDate(0, -n, 0)
+	for i := range quotes {
+		quotes[i] = PriceQuote{
+			Date: start.AddDate(0, i, 0),
+			Open: price, High: price, Low: price, Close: price,
+			Volume: 1000,
+			AdjClose: price,
+		}
+		price *= 1.01
+	}
+	return quotes
+}
+
+func TestPriceSource_Chain(t *testing.T) {
+	empty := &fakePriceSource{name: "empty"}
+	full := &fakePriceSource{
+		name: "full",
+		quotes: map[string][]PriceQuote{"FOO": monthlyQuotes(24)},
+	}
+	db := newDb(t, empty, full)
+
+	s, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if n := s.Prices().NumPrices(); n < 20 { t.Fatal("Too few prices: ", n) }
+	if empty.numFetches != 1 || full.numFetches != 1 {
+		t.Error("Fetches: ", empty.numFetches, full.numFetches)
+	}
+
+	_, err = db.FindSecurity("BAR")
+	if !errors.Is(err, ErrUnknownTicker) { t.Error(err) }
+}
+
+type brokenPriceSource struct {}
+
+func (s brokenPriceSource) Name() string { return "broken" }
+
+func (s brokenPriceSource) Fetch(ticker string) ([]PriceQuote, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestPriceSource_Unavailable(t *testing.T) {
+	empty := &fakePriceSource{name: "empty"}
+	db := newDb(t, brokenPriceSource{}, empty)
+	_, err := db.FindSecurity("FOO")
+	if !errors.Is(err, ErrSourceUnavailable) { t.Error(err) }
+}
+
+func TestPriceSource_Registry(t *testing.T) {
+	s, err := NewPriceSource("yahoo:http://example.com/%s.csv")
+	if err != nil { t.Fatal(err) }
+	if s.Name() != "yahoo" { t.Error(s.Name()) }
+	if s.(*yahooPriceSource).urlFormat != "http://example.com/%s.csv" {
+		t.Error(s.(*yahooPriceSource).urlFormat)
+	}
+
+	_, err = NewPriceSource("nosuchsource")
+	if err == nil { t.Error("Expected an error for unknown source") }
+}
+
+func TestPriceSource_CsvDir(t *testing.T) {
+	dir := "/tmp/portopt_test/csvdir"
+	err := os.MkdirAll(dir, 0700)
+	if err != nil { t.Fatal(err) }
+	data, err := ioutil.ReadFile("C.bak")
+	if err != nil { t.Fatal(err) }
+	err = ioutil.WriteFile(filepath.Join(dir, "C.csv"), data, 0600)
+	if err != nil { t.Fatal(err) }
+
+	source, err := NewPriceSource("csvdir:" + dir)
+	if err != nil { t.Fatal(err) }
+	tickers, err := source.(*CsvDirPriceSource).Tickers()
+	if err != nil { t.Fatal(err) }
+	if len(tickers) != 1 || tickers[0] != "C" { t.Error(tickers) }
+
+	db := newDb(t, source)
+	s, err := db.FindSecurity("C")
+	if err != nil { t.Fatal(err) }
+	if n := s.Prices().NumPrices(); n < 100 { t.Fatal("Too few prices: ", n) }
+
+	_, err = db.FindSecurity("NOSUCHTICKER")
+	if !errors.Is(err, ErrUnknownTicker) { t.Error(err) }
+
+	// Tickers can't name files outside the directory.
+	err = ioutil.WriteFile("/tmp/portopt_test/OUTSIDE.csv", data, 0600)
+	if err != nil { t.Fatal(err) }
+	for _, ticker := range []string{"../OUTSIDE", "..\\OUTSIDE", "/tmp/portopt_test/OUTSIDE"} {
+		_, err := source.Fetch(ticker)
+		if !errors.Is(err, ErrUnknownTicker) { t.Error(ticker, err) }
+	}
+}
@@ -0,0 +1,89 @@
+package portopt
+
+import "strings"
+import "time"
+
+// Controls when FindSecurity fetches new prices for a ticker from the price
+// sources. A ticker with no prices at all is always fetched. Refreshes
+// fetch only the quotes after the newest one in the price table.
+type RefreshPolicy struct {
+	// Refresh a ticker whose newest quote is older than MaxAge. Also,
+	// FindSecurity reloads a cached security after MaxAge, so a
+	// long-lived Database picks up new quotes. Zero disables both.
+	MaxAge time.Duration
+
+	// Refresh every ticker the first time the Database loads it,
+	// regardless of its age.
+	OnOpen bool
+
+	// Never refresh a ticker that has prices, e.g., for reproducible
+	// research. Overrides MaxAge and OnOpen.
+	Never bool
+}
+
+var DefaultRefreshPolicy = RefreshPolicy{MaxAge: time.Hour * 24 * 30 * 2}
+
+// True if prices whose newest quote is dated last should be refreshed.
+// firstLoad is true if the Database hasn't loaded the ticker yet.
+func (p RefreshPolicy) stale(last time.Time, firstLoad bool, now time.Time) bool {
+	if last.IsZero() { return true }
+	if p.Never { return false }
+	if p.OnOpen && firstLoad { return true }
+	return p.MaxAge > 0 && now.Sub(last) >= p.MaxAge
+}
+
+// True if a security cached at loadTime should be checked for staleness
+// again.
+func (p RefreshPolicy) recheck(loadTime time.Time, now time.Time) bool {
+	return !p.Never && p.MaxAge > 0 && now.Sub(loadTime) >= p.MaxAge
+}
+
+func (db *Database) SetRefreshPolicy(p RefreshPolicy) { db.refresh = p }
+
+func (db *Database) RefreshPolicy() RefreshPolicy { return db.refresh }
+
+// Fetch new quotes for the tickers now, regardless of the refresh policy,
+// and drop their cached stats. Returns the first error, after trying all
+// the tickers.
+func (db *Database) Refresh(tickers... string) (error) {
+	var firstErr error
+	for _, ticker := range tickers {
+		last, err := db.lastQuoteDate(ticker)
+		if err == nil {
+			err = db.fillFromSources(ticker, last)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		db.forget(ticker)
+	}
+	return firstErr
+}
+
+// The date of the newest quote for the ticker, or zero if there is none.
+func (db Database) lastQuoteDate(ticker string) (time.Time, error) {
+	rows, err := db.Query("SELECT MAX(date) FROM price WHERE ticker = ?", ticker)
+	if err != nil || rows[0][0] == nil {
+		return time.Time{}, err
+	}
+	return time.Unix(rows[0][0].(int64), 0), nil
+}
+
+// Drop the cached security and any cached stats or correlation involving
+// it.
+func (db *Database) forget(ticker string) {
+	delete(db.cachedSecurities, ticker)
+	db.statsCache.RemoveIf(func(key interface{}) bool {
+		return key.(statsKey).ticker == ticker
+	})
+	db.correlationCache.RemoveIf(func(key interface{}) bool {
+		k := key.(correlationKey)
+		return k.ticker1 == ticker || k.ticker2 == ticker
+	})
+	db.matrixCache.RemoveIf(func(key interface{}) bool {
+		for _, t := range strings.Split(key.(jointStatsKey).tickers, "\x00") {
+			if t == ticker { return true }
+		}
+		return false
+	})
+}
@@ -0,0 +1,121 @@
+package portopt
+
+import "testing"
+import "time"
+
+// A fakePriceSource that also records the dates passed to FetchSince.
+type incrementalPriceSource struct {
+	fakePriceSource
+	sinces []time.Time
+}
+
+func (s *incrementalPriceSource) FetchSince(ticker string, since time.Time) ([]PriceQuote, error) {
+	s.sinces = append(s.sinces, since)
+	quotes, err := s.Fetch(ticker)
+	return quotesSince(quotes, since), err
+}
+
+func newIncrementalSource(quotes []PriceQuote) *incrementalPriceSource {
+	return &incrementalPriceSource{fakePriceSource: fakePriceSource{
+		name: "incr",
+		quotes: map[string][]PriceQuote{"FOO": quotes},
+	}}
+}
+
+func TestRefresh_Tail(t *testing.T) {
+	quotes := monthlyQuotes(24)
+	source := newIncrementalSource(quotes[:12])
+	db := newDb(t, source)
+	_, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if source.numFetches != 1 { t.Fatal(source.numFetches) }
+
+	// The last quote is now a year old, so the next Database refreshes
+	// it from the last stored date.
+	source.quotes["FOO"] = quotes
+	db, err = CreateDb(db.Path, source)
+	if err != nil { t.Fatal(err) }
+	s, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if len(source.sinces) != 1 || source.sinces[0].Unix() != quotes[11].Date.Unix() {
+		t.Error(source.sinces)
+	}
+	if n := s.Prices().NumPrices(); n < 23 { t.Error(n) }
+}
+
+func TestRefresh_Never(t *testing.T) {
+	quotes := monthlyQuotes(24)
+	source := newIncrementalSource(quotes[:12])
+	db := newDb(t, source)
+	_, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+
+	db, err = CreateDb(db.Path, source)
+	if err != nil { t.Fatal(err) }
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	_, err = db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if source.numFetches != 1 { t.Error(source.numFetches) }
+}
+
+func TestRefresh_OnOpenAndForce(t *testing.T) {
+	source := newIncrementalSource(monthlyQuotes(24))
+	db := newDb(t, source)
+	db.SetRefreshPolicy(RefreshPolicy{OnOpen: true})
+	_, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if source.numFetches != 1 { t.Error(source.numFetches) }
+
+	// Recent prices, but OnOpen refreshes them on the first load.
+	db, err = CreateDb(db.Path, source)
+	if err != nil { t.Fatal(err) }
+	db.SetRefreshPolicy(RefreshPolicy{OnOpen: true})
+	s1, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if source.numFetches != 2 { t.Error(source.numFetches) }
+
+	err = db.Refresh("FOO")
+	if err != nil { t.Fatal(err) }
+	if source.numFetches != 3 { t.Error(source.numFetches) }
+	s2, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if s1 == s2 { t.Error("Security not reloaded after Refresh") }
+}
+
+func TestRefresh_RecheckCached(t *testing.T) {
+	source := newIncrementalSource(monthlyQuotes(24))
+	db := newDb(t, source)
+	db.SetRefreshPolicy(RefreshPolicy{MaxAge: time.Nanosecond})
+	s1, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	time.Sleep(time.Millisecond)
+	s2, err := db.FindSecurity("FOO")
+	if err != nil { t.Fatal(err) }
+	if s1 == s2 { t.Error("Cached security not rechecked") }
+}
+
+func TestRefresh_NothingNewKeepsCorrelations(t *testing.T) {
+	quotes := monthlyQuotes(24)
+	source := newIncrementalSource(quotes)
+	source.quotes["BAR"] = quotes
+	db := newDb(t, source)
+	_, err := db.Correlation("FOO", "BAR", allTime)
+	if err != nil { t.Fatal(err) }
+
+	// Refetches the last stored quote, which hasn't changed.
+	err = db.Refresh("FOO")
+	if err != nil { t.Fatal(err) }
+	rows, err := db.Query("SELECT COUNT(*) FROM correlation")
+	if err != nil { t.Fatal(err) }
+	if rows[0][0].(int64) != 1 { t.Error(rows) }
+
+	// A revised quote does invalidate them.
+	quotes[23].AdjClose *= 1.1
+	err = db.Refresh("FOO")
+	if err != nil { t.Fatal(err) }
+	rows, err = db.Query("SELECT COUNT(*) FROM correlation")
+	if err != nil { t.Fatal(err) }
+	if rows[0][0].(int64) != 0 { t.Error(rows) }
+}
@@ -0,0 +1,59 @@
+package portopt
+
+import "fmt"
+import "math"
+import "time"
+
+// How the return of a period is computed from the prices p0 at its start
+// and p1 at its end.
+type ReturnType int
+
+const (
+	// p1 / p0 - 1.
+	SimpleReturns ReturnType = iota
+
+	// log(p1 / p0). Log returns add up over time: their sum is the log of
+	// the total growth.
+	LogReturns
+)
+
+func (t ReturnType) String() string {
+	switch t {
+	case SimpleReturns: return "simple"
+	case LogReturns: return "log"
+	}
+	return fmt.Sprintf("ReturnType(%d)", int(t))
+}
+
+func (t ReturnType) delta(value float64, lastValue float64) float64 {
+	if t == LogReturns {
+		return math.Log(value / lastValue)
+	}
+	return (value - lastValue) / lastValue
+}
+
+// Set the kind of returns that Stats, Correlation and the covariance
+// matrices are computed over. The default is SimpleReturns.
+func (db *Database) SetReturnType(t ReturnType) {
+	db.returnType = t
+	db.statsCache.Clear()
+	db.correlationCache.Clear()
+	db.matrixCache.Clear()
+}
+
+func (db *Database) ReturnType() ReturnType { return db.returnType }
+
+// A statsAccumulator for the database's ReturnType.
+func (db *Database) newAccumulator(label string) *statsAccumulator {
+	acc := newStatsAccumulator(label)
+	acc.returnType = db.returnType
+	return acc
+}
+
+// Average length of a year, for converting per-period figures.
+const year = time.Duration(time.Hour * 24 * 36525 / 100)
+
+// Number of sampling periods of r in a year.
+func (r *dateRange) PeriodsPerYear() float64 {
+	return float64(year) / float64(r.samplingInterval)
+}
@@ -0,0 +1,83 @@
+package portopt
+
+import "math"
+import "os"
+import "testing"
+
+func TestStats_ReturnType(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+
+	simple, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(simple.ArithmeticMean - simple.PerPeriodReturn) > 1e-15 { t.Error(simple) }
+	if simple.GeometricMean >= simple.ArithmeticMean { t.Error(simple) }
+	want := math.Pow(1 + simple.GeometricMean, allTime.PeriodsPerYear()) - 1
+	if math.Abs(simple.CAGR - want) > 1e-12 { t.Error(simple.CAGR, want) }
+	if _, err := db.Correlation("C", "D", allTime); err != nil { t.Fatal(err) }
+
+	db.SetReturnType(LogReturns)
+	if db.ReturnType() != LogReturns { t.Error(db.ReturnType()) }
+	log, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	if log.PerPeriodReturn >= simple.PerPeriodReturn { t.Error(log, simple) }
+	if log.ArithmeticMean != simple.ArithmeticMean || log.GeometricMean != simple.GeometricMean ||
+		log.TotalReturn != simple.TotalReturn { t.Error(log, simple) }
+
+	// Correlations of simple and log returns are stored separately.
+	if _, err := db.Correlation("C", "D", allTime); err != nil { t.Fatal(err) }
+	rows, err := db.Query("SELECT returnType FROM correlation ORDER BY returnType")
+	if err != nil { t.Fatal(err) }
+	if len(rows) != 2 || rows[0][0].(int64) != 0 || rows[1][0].(int64) != 1 { t.Error(rows) }
+}
+
+func TestStats_Annualized(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+
+	monthly, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	quarterly, err := db.Stats("C", NewDateRange(allTime.Start(), allTime.End(), minInterval * 3))
+	if err != nil { t.Fatal(err) }
+	if math.Abs(monthly.AnnualizedReturn() - 12.175 * monthly.PerPeriodReturn) > 1e-3 { t.Error(monthly) }
+	ratio := quarterly.AnnualizedReturn() / monthly.AnnualizedReturn()
+	if ratio < 0.8 || ratio > 1.25 { t.Error(quarterly.AnnualizedReturn(), monthly.AnnualizedReturn()) }
+
+	p := NewPortfolio(db, allTime, map[string]float64{"C": 1.0})
+	pstats, err := p.Stats()
+	if err != nil { t.Fatal(err) }
+	if math.Abs(pstats.AnnualizedReturn() - monthly.AnnualizedReturn()) > 1e-12 ||
+		math.Abs(pstats.AnnualizedVolatility() - monthly.AnnualizedStddev()) > 1e-12 {
+		t.Error(pstats, monthly)
+	}
+}
+
+func TestStats_AnnualizedShortHistory(t *testing.T) {
+	// Three returns of 1%: the annualized return is 1% a period, not
+	// diluted by the first price.
+	db := newDb(t)
+	db.SetRefreshPolicy(RefreshPolicy{Never: true})
+	path := "/tmp/portopt_test/short.csv"
+	err := os.WriteFile(path, []byte("Date,Close\n2012-01-02,100\n2012-02-01,101\n2012-03-01,102.01\n2012-04-02,103.0301\n"), 0600)
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv(path, "FOO")
+	if err != nil { t.Fatal(err) }
+
+	want := 0.01 * allTime.PeriodsPerYear()
+	stats, err := db.Stats("FOO", allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(stats.AnnualizedReturn() - want) > 1e-9 { t.Error(stats.AnnualizedReturn(), want) }
+
+	p := NewPortfolio(db, allTime, map[string]float64{"FOO": 1.0})
+	pstats, err := p.Stats()
+	if err != nil { t.Fatal(err) }
+	if math.Abs(pstats.AnnualizedReturn() - want) > 1e-9 { t.Error(pstats.AnnualizedReturn(), want) }
+	f := newFrontier()
+	f.Insert(pstats.PerPeriodReturn(), pstats.Volatility(), p)
+	f.Annualize(allTime.PeriodsPerYear())
+	if m := f.Iterate().AnnualizedMean(); math.Abs(m - want) > 1e-9 { t.Error(m, want) }
+}
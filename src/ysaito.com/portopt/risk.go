@@ -0,0 +1,34 @@
+package portopt
+
+import "fmt"
+
+// The risk that Portfolio.Stats reports in PortfolioStats.Risk, e.g., for
+// ranking portfolios on a frontier.
+type RiskMeasure int
+
+const (
+	// The standard deviation of the per-period returns, i.e.,
+	// PortfolioStats.Volatility.
+	StddevRisk RiskMeasure = iota
+
+	// The Cornish-Fisher VaR at ModifiedRiskConfidence, which accounts
+	// for the skewness and kurtosis of the returns.
+	ModifiedVaRRisk
+)
+
+// Confidence level of ModifiedVaRRisk.
+const ModifiedRiskConfidence = 0.95
+
+func (m RiskMeasure) String() string {
+	switch m {
+	case StddevRisk: return "stddev"
+	case ModifiedVaRRisk: return "modified-var"
+	}
+	return fmt.Sprintf("RiskMeasure(%d)", int(m))
+}
+
+// Set the risk measure of PortfolioStats.Risk. It doesn't affect the
+// stats that a Portfolio has already computed. The default is StddevRisk.
+func (db *Database) SetRiskMeasure(m RiskMeasure) { db.riskMeasure = m }
+
+func (db *Database) RiskMeasure() RiskMeasure { return db.riskMeasure }
@@ -0,0 +1,203 @@
+package portopt
+
+import "encoding/csv"
+import "fmt"
+import "io"
+import "os"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+// The annual risk-free rate from date on, e.g., 0.05 for 5%.
+type riskFreeQuote struct {
+	date time.Time
+	rate float64
+}
+
+// Parse a CSV stream of risk-free rates whose first row is a header. The
+// column named "Date" has the date, and the first other column has the
+// annual rate in percent, as in the T-bill yield series published by FRED
+// (e.g., DTB3). Rows whose rate is not a number, such as FRED's "." for
+// holidays, are reported in report.Skipped.
+func parseRiskFreeCsv(in io.Reader) (quotes []riskFreeQuote, report *ImportReport, err error) {
+	report = new(ImportReport)
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, report, fmt.Errorf("%w: empty CSV file", ErrMalformedRow)
+	}
+	if err != nil {
+		return nil, report, fmt.Errorf("%w: %v", ErrMalformedRow, err)
+	}
+	dateCol, rateCol := -1, -1
+	for i, name := range header {
+		if strings.ToLower(strings.TrimSpace(name)) == "date" {
+			if dateCol < 0 { dateCol = i }
+		} else if rateCol < 0 {
+			rateCol = i
+		}
+	}
+	if dateCol < 0 || rateCol < 0 {
+		return nil, report, fmt.Errorf("%w: CSV header needs a Date and a rate column: %v", ErrMalformedRow, header)
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, report, fmt.Errorf("%w: %v", ErrMalformedRow, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if dateCol >= len(row) || rateCol >= len(row) {
+			report.Skipped = append(report.Skipped, SkippedRow{Line: line, Reason: fmt.Sprintf("%v: expect at least %d fields, found %d", ErrMalformedRow, rateCol + 1, len(row))})
+			continue
+		}
+		matches := dateRe.FindStringSubmatch(strings.TrimSpace(row[dateCol]))
+		if matches == nil {
+			report.Skipped = append(report.Skipped, SkippedRow{Line: line, Reason: fmt.Sprintf("%v: bad date %q", ErrMalformedRow, row[dateCol])})
+			continue
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSpace(row[rateCol]), 64)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedRow{Line: line, Reason: fmt.Sprintf("%v: bad rate %q", ErrMalformedRow, row[rateCol])})
+			continue
+		}
+		year, _ := strconv.Atoi(matches[1])
+		month, _ := strconv.Atoi(matches[2])
+		day, _ := strconv.Atoi(matches[3])
+		quotes = append(quotes, riskFreeQuote{
+			date: time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC),
+			rate: percent / 100,
+		})
+	}
+	return quotes, report, nil
+}
+
+// Import a CSV file of risk-free rates into the riskfree table, replacing
+// existing rows for the same dates; see parseRiskFreeCsv. Afterwards the
+// stats use the rates in the table rather than any rate set by
+// SetRiskFreeRate.
+func (db *Database) FillRiskFreeFromCsv(path string) (*ImportReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	quotes, report, err := parseRiskFreeCsv(file)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", path, err)
+	}
+	before, err := db.countRiskFree()
+	if err != nil { return report, err }
+	err = db.inTransaction(func() error {
+		for _, q := range quotes {
+			err := db.Exec("INSERT OR REPLACE INTO riskfree VALUES(?, ?)", q.date.Unix(), q.rate)
+			if err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil { return report, err }
+	after, err := db.countRiskFree()
+	if err != nil { return report, err }
+	report.Inserted = len(quotes)
+	report.Replaced += len(quotes) - (after - before)
+
+	db.constantRiskFree = false
+	db.riskFree = nil
+	db.statsCache.Clear()
+	return report, nil
+}
+
+func (db *Database) countRiskFree() (int, error) {
+	rows, err := db.Query("SELECT COUNT(*) FROM riskfree")
+	if err != nil { return 0, err }
+	return int(rows[0][0].(int64)), nil
+}
+
+// Use a constant annual risk-free rate, e.g., 0.02 for 2%, instead of the
+// riskfree table. Without either, the risk-free rate is 0.
+func (db *Database) SetRiskFreeRate(annualRate float64) {
+	db.constantRiskFree = true
+	db.riskFree = []riskFreeQuote{{time.Time{}, annualRate}}
+	db.statsCache.Clear()
+}
+
+// The risk-free rates in effect, oldest first. Reads the riskfree table
+// the first time.
+func (db *Database) riskFreeRates() ([]riskFreeQuote, error) {
+	if db.riskFree != nil {
+		return db.riskFree, nil
+	}
+	rows, err := db.Query("SELECT date, rate FROM riskfree ORDER BY date")
+	if err != nil { return nil, err }
+	rates := make([]riskFreeQuote, len(rows))
+	for i, row := range rows {
+		rates[i] = riskFreeQuote{time.Unix(row[0].(int64), 0).UTC(), row[1].(float64)}
+	}
+	if len(rates) == 0 {
+		rates = []riskFreeQuote{{time.Time{}, 0}}
+	}
+	db.riskFree = rates
+	return rates, nil
+}
+
+// Risk-free returns between consecutive dates: result[k] is earned from
+// dates[k] to dates[k+1] at the rate in effect on dates[k], or the oldest
+// rate if dates[k] precedes all of them.
+func (db *Database) riskFreeReturns(dates []time.Time) ([]float64, error) {
+	rates, err := db.riskFreeRates()
+	if err != nil { return nil, err }
+	if len(dates) < 2 {
+		return []float64{}, nil
+	}
+	returns := make([]float64, len(dates) - 1)
+	for k := range returns {
+		i := sort.Search(len(rates), func(i int) bool { return rates[i].date.After(dates[k]) }) - 1
+		if i < 0 { i = 0 }
+		years := float64(dates[k + 1].Sub(dates[k])) / float64(year)
+		returns[k] = rates[i].rate * years
+	}
+	return returns, nil
+}
+
+// Mean risk-free return per sampling period of r, e.g., to draw the
+// capital market line of a frontier of per-period returns.
+func (db *Database) RiskFreeReturn(r *dateRange) (float64, error) {
+	dates := []time.Time{}
+	for iter := r.Begin(); !iter.Done(); iter.Next() {
+		dates = append(dates, iter.Time())
+	}
+	returns, err := db.riskFreeReturns(dates)
+	if err != nil || len(returns) == 0 { return 0, err }
+	mean, _, _, _ := moments(returns)
+	return mean, nil
+}
+
+// Returns in excess of the risk-free rate.
+type ExcessReturns struct {
+	// Mean per-period simple return minus the mean risk-free return.
+	ExcessReturn float64
+
+	// ExcessReturn over the standard deviation of the excess returns.
+	// Zero if that deviation is zero.
+	Sharpe float64
+}
+
+func excessReturns(returns []float64, riskFree []float64) ExcessReturns {
+	doAssert(len(returns) == len(riskFree), len(returns), " ", len(riskFree))
+	excess := make([]float64, len(returns))
+	for k, r := range returns {
+		excess[k] = r - riskFree[k]
+	}
+	var result ExcessReturns
+	mean, stddev, _, _ := moments(excess)
+	result.ExcessReturn = mean
+	if stddev > 0 {
+		result.Sharpe = mean / stddev
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package portopt
+
+import "math"
+import "os"
+import "testing"
+import "time"
+
+func TestRiskFree_Csv(t *testing.T) {
+	db := newDb(t)
+	path := "/tmp/portopt_test/dtb3.csv"
+	err := os.WriteFile(path, []byte("DATE,DTB3\n2000-01-01,6.0\n2000-01-03,.\n2001-01-01,3.0\n2001-01-01,2.0\n"), 0600)
+	if err != nil { t.Fatal(err) }
+	report, err := db.FillRiskFreeFromCsv(path)
+	if err != nil { t.Fatal(err) }
+	if report.Inserted != 3 || report.Replaced != 1 || len(report.Skipped) != 1 || report.Skipped[0].Line != 3 { t.Error(report) }
+
+	dates := []time.Time{
+		time.Date(1999, time.Month(1), 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2000, time.Month(7), 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2001, time.Month(7), 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2001, time.Month(8), 1, 0, 0, 0, 0, time.UTC),
+	}
+	returns, err := db.riskFreeReturns(dates)
+	if err != nil { t.Fatal(err) }
+	// Before the first rate, the first rate applies.
+	want := []float64{
+		0.06 * float64(dates[1].Sub(dates[0])) / float64(year),
+		0.06 * float64(dates[2].Sub(dates[1])) / float64(year),
+		0.02 * float64(dates[3].Sub(dates[2])) / float64(year),
+	}
+	if !floatsEqual(returns, want) { t.Error(returns, want) }
+
+	db.SetRiskFreeRate(0.12)
+	returns, err = db.riskFreeReturns(dates[2:])
+	if err != nil { t.Fatal(err) }
+	if math.Abs(returns[0] - 0.12 * 31 / 365.25) > 1e-12 { t.Error(returns) }
+}
+
+func TestStats_Sharpe(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+
+	// No rate loaded: the risk-free rate is 0.
+	stats, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	if stats.Sharpe == 0 || math.Abs(stats.AnnualizedSharpe() - stats.Sharpe * math.Sqrt(allTime.PeriodsPerYear())) > 1e-12 { t.Error(stats) }
+
+	db.SetRiskFreeRate(0.05)
+	rf, err := db.RiskFreeReturn(allTime)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(rf - 0.05 / allTime.PeriodsPerYear()) > 1e-12 { t.Error(rf) }
+	excess, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	if excess.ExcessReturn >= stats.ExcessReturn || excess.Sharpe >= stats.Sharpe { t.Error(excess, stats) }
+
+	p := NewPortfolio(db, allTime, map[string]float64{"C": 1.0})
+	pstats, err := p.Stats()
+	if err != nil { t.Fatal(err) }
+	if math.Abs(pstats.Sharpe - excess.Sharpe) > 1e-9 { t.Error(pstats.Sharpe, excess.Sharpe) }
+}
+
+func TestStats_RiskFreeErrorNotCached(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	if err := db.Exec("DROP TABLE riskfree"); err != nil { t.Fatal(err) }
+
+	p := NewPortfolio(db, allTime, map[string]float64{"C": 1.0})
+	if _, err := p.Stats(); err == nil { t.Fatal("Stats succeeded without the riskfree table") }
+	if _, err := p.Stats(); err == nil { t.Error("Stats cached partial stats") }
+}
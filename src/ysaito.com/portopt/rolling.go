@@ -0,0 +1,113 @@
+package portopt
+
+import "fmt"
+import "time"
+
+// Values indexed by time.
+type TimeSeries struct {
+	Dates []time.Time
+	Values []float64
+}
+
+func (s *TimeSeries) add(t time.Time, v float64) {
+	s.Dates = append(s.Dates, t)
+	s.Values = append(s.Values, v)
+}
+
+// Statistics over trailing windows of sampling periods. The value at a date
+// is computed over the window that ends with the period starting at that
+// date. Windows count the periods kept by the missing data policy, and the
+// first value is for the first full window.
+type RollingStats struct {
+	// Mean and standard deviation of the simple returns in the window.
+	Mean TimeSeries
+	Volatility TimeSeries
+
+	// The largest peak-to-trough fall within the window.
+	MaxDrawdown TimeSeries
+}
+
+// Rolling statistics of the simple returns relative to those of a
+// benchmark, as in BenchmarkStats. Zero in windows in which either series
+// is flat. See RollingStats.
+type RollingBenchmarkStats struct {
+	Benchmark string
+	Correlation TimeSeries
+	Beta TimeSeries
+}
+
+// Compute RollingStats from values at dates, over windows of window
+// periods.
+func rollingStats(dates []time.Time, values []float64, window int, r *dateRange) *RollingStats {
+	rs := new(RollingStats)
+	returns := periodReturns(values)
+	for end := window; end < len(values); end++ {
+		mean, sd, _, _ := moments(returns[end - window:end])
+		rs.Mean.add(dates[end], mean)
+		rs.Volatility.add(dates[end], sd)
+		risk := downsideRisk(dates[end - window:end + 1], values[end - window:end + 1], 0, r.PeriodsPerYear())
+		rs.MaxDrawdown.add(dates[end], risk.MaxDrawdown)
+	}
+	return rs
+}
+
+// Compute RollingBenchmarkStats from aligned values at dates.
+func rollingBenchmarkStats(benchmark string, dates []time.Time, values []float64, benchValues []float64, window int) *RollingBenchmarkStats {
+	rs := &RollingBenchmarkStats{Benchmark: benchmark}
+	returns := periodReturns(values)
+	benchReturns := periodReturns(benchValues)
+	riskFree := make([]float64, window)  // beta doesn't depend on it
+	for end := window; end < len(values); end++ {
+		r := returns[end - window:end]
+		b := benchReturns[end - window:end]
+		rs.Correlation.add(dates[end], pearson(r, b))
+		rs.Beta.add(dates[end], benchmarkStats(benchmark, r, b, riskFree).Beta)
+	}
+	return rs
+}
+
+func checkWindow(window int) error {
+	if window < 1 {
+		return fmt.Errorf("Window must be at least one period, got %d", window)
+	}
+	return nil
+}
+
+// Statistics of the ticker over trailing windows of window sampling
+// periods of r.
+func (db *Database) RollingStats(ticker string, r *dateRange, window int) (*RollingStats, error) {
+	if err := checkWindow(window); err != nil { return nil, err }
+	js, err := db.jointStats([]string{ticker}, r)
+	if err != nil { return nil, err }
+	return rollingStats(js.dates, js.prices[0], window, js.dateRange), nil
+}
+
+// Correlation and beta of the ticker against the benchmark over trailing
+// windows of window sampling periods of r.
+func (db *Database) RollingBenchmarkStats(ticker string, benchmark string, r *dateRange, window int) (*RollingBenchmarkStats, error) {
+	if err := checkWindow(window); err != nil { return nil, err }
+	js, err := db.jointStats([]string{ticker, benchmark}, r)
+	if err != nil { return nil, err }
+	return rollingBenchmarkStats(benchmark, js.dates, js.prices[0], js.prices[1], window), nil
+}
+
+// Statistics of the portfolio, rebalanced to its weights every sampling
+// period, over trailing windows of window periods of its date range.
+func (p *Portfolio) RollingStats(window int) (*RollingStats, error) {
+	if err := checkWindow(window); err != nil { return nil, err }
+	tickers, weights := p.normalizedWeights()
+	js, err := p.Db().jointStats(tickers, p.DateRange())
+	if err != nil { return nil, err }
+	return rollingStats(js.dates, rebalancedValues(js, weights), window, js.dateRange), nil
+}
+
+// Correlation and beta of the portfolio against the benchmark over
+// trailing windows of window periods of its date range.
+func (p *Portfolio) RollingBenchmarkStats(benchmark string, window int) (*RollingBenchmarkStats, error) {
+	if err := checkWindow(window); err != nil { return nil, err }
+	tickers, weights := p.normalizedWeights()
+	js, err := p.Db().jointStats(append(tickers, benchmark), p.DateRange())
+	if err != nil { return nil, err }
+	return rollingBenchmarkStats(benchmark, js.dates,
+		rebalancedValues(js, weights), js.prices[len(tickers)], window), nil
+}
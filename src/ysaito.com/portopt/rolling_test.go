@@ -0,0 +1,109 @@
+package portopt
+
+import "math"
+import "math/rand"
+import "testing"
+
+func TestRollingStats(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+
+	_, err = db.RollingStats("C", allTime, 0)
+	if err == nil { t.Error("Expect an error for an empty window") }
+
+	rs, err := db.RollingStats("C", allTime, 12)
+	if err != nil { t.Fatal(err) }
+	s, err := db.FindSecurity("C")
+	if err != nil { t.Fatal(err) }
+	n := s.Prices().NumPrices()
+	if len(rs.Mean.Values) != n - 12 || len(rs.Volatility.Dates) != n - 12 || len(rs.MaxDrawdown.Values) != n - 12 {
+		t.Fatal(len(rs.Mean.Values), n)
+	}
+	for i, dd := range rs.MaxDrawdown.Values {
+		if dd < 0 || dd >= 1 { t.Error(i, dd) }
+	}
+
+	// A window covering the whole history matches Stats.
+	stats, err := db.Stats("C", allTime)
+	if err != nil { t.Fatal(err) }
+	rs, err = db.RollingStats("C", allTime, n - 1)
+	if err != nil { t.Fatal(err) }
+	if len(rs.Mean.Values) != 1 || math.Abs(rs.Mean.Values[0] - stats.PerPeriodReturn) > 1e-12 ||
+		math.Abs(rs.Volatility.Values[0] - stats.Stddev) > 1e-12 || rs.MaxDrawdown.Values[0] != stats.MaxDrawdown {
+		t.Error(rs, stats)
+	}
+
+	bs, err := db.RollingBenchmarkStats("C", "D", allTime, 24)
+	if err != nil { t.Fatal(err) }
+	if len(bs.Beta.Values) != n - 24 { t.Fatal(len(bs.Beta.Values)) }
+	for i := range bs.Beta.Values {
+		if math.Abs(bs.Beta.Values[i] - 1) > 1e-9 || math.Abs(bs.Correlation.Values[i] - 1) > 1e-9 {
+			t.Error(i, bs.Beta.Values[i], bs.Correlation.Values[i])
+		}
+	}
+
+	rs, err = db.RollingStats("C", allTime, 12)
+	if err != nil { t.Fatal(err) }
+	p := NewPortfolio(db, allTime, map[string]float64{"C": 1.0})
+	prs, err := p.RollingStats(12)
+	if err != nil { t.Fatal(err) }
+	if len(prs.Volatility.Values) != n - 12 || math.Abs(prs.Volatility.Values[5] - rs.Volatility.Values[5]) > 1e-12 {
+		t.Error(prs.Volatility.Values[5], rs.Volatility.Values[5])
+	}
+	pbs, err := p.RollingBenchmarkStats("D", 12)
+	if err != nil { t.Fatal(err) }
+	if math.Abs(pbs.Beta.Values[0] - 1) > 1e-9 { t.Error(pbs.Beta.Values[0]) }
+}
+
+func TestRollingBenchmarkStats_Windows(t *testing.T) {
+	// Two different noisy series; the benchmark is flat for its first
+	// year.
+	rng := rand.New(rand.NewSource(1))
+	foo := monthlyQuotes(48)
+	bar := monthlyQuotes(48)
+	for i := range foo {
+		foo[i].AdjClose *= 1 + rng.NormFloat64() * 0.05
+		if i >= 12 {
+			bar[i].AdjClose *= 1 + rng.NormFloat64() * 0.05
+		} else {
+			bar[i].AdjClose = 10
+		}
+	}
+	db := newDb(t, &fakePriceSource{name: "fake", quotes: map[string][]PriceQuote{"FOO": foo, "BAR": bar}})
+
+	bs, err := db.RollingBenchmarkStats("FOO", "BAR", allTime, 6)
+	if err != nil { t.Fatal(err) }
+	js, err := db.jointStats([]string{"FOO", "BAR"}, allTime)
+	if err != nil { t.Fatal(err) }
+	returns := periodReturns(js.prices[0])
+	benchReturns := periodReturns(js.prices[1])
+	if len(bs.Beta.Values) != len(returns) - 5 { t.Fatal(len(bs.Beta.Values), len(returns)) }
+	for i := range bs.Beta.Values {
+		r := returns[i:i + 6]
+		b := benchReturns[i:i + 6]
+		want := benchmarkStats("BAR", r, b, make([]float64, 6))
+		if math.Abs(bs.Beta.Values[i] - want.Beta) > 1e-12 { t.Error(i, bs.Beta.Values[i], want.Beta) }
+		corr := bs.Correlation.Values[i]
+		if math.Abs(corr * corr - want.RSquared) > 1e-9 { t.Error(i, corr, want.RSquared) }
+	}
+	if bs.Beta.Values[0] != 0 || bs.Correlation.Values[0] != 0 { t.Error(bs.Beta.Values[0], bs.Correlation.Values[0]) }
+	if bs.Correlation.Values[len(bs.Correlation.Values) - 1] == 0 { t.Error(bs.Correlation.Values) }
+}
+
+func TestRollingStats_ShortWindow(t *testing.T) {
+	f := newStatsFixture(t, "A", map[string][]float64{"A": compound(0.1, -0.1, 0.1, 0.2)})
+	rs, err := f.db.RollingStats("A", allTime, 3)
+	if err != nil { t.Fatal(err) }
+	// Windows of the returns (0.1, -0.1, 0.1) and (-0.1, 0.1, 0.2).
+	wantMean := []float64{1.0 / 30, 1.0 / 15}
+	wantVol := []float64{math.Sqrt(8.0 / 900), math.Sqrt(0.02 - 1.0 / 225)}
+	if len(rs.Mean.Values) != 2 { t.Fatal(rs.Mean) }
+	for i := range wantMean {
+		if math.Abs(rs.Mean.Values[i] - wantMean[i]) > 1e-12 || math.Abs(rs.Volatility.Values[i] - wantVol[i]) > 1e-12 {
+			t.Error(i, rs.Mean.Values[i], rs.Volatility.Values[i])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package portopt
+
+import "github.com/kuroneko/gosqlite3"
+import "fmt"
+import "log"
+import "time"
+
+// A schema change. Migrations are applied in order of Version by CreateDb,
+// and the schema_version table records the ones already applied. Never
+// change or reorder a migration once released; append a new one instead.
+type Migration struct {
+	Version int
+	Description string
+	apply func(db *Database) error
+}
+
+var migrations = []Migration{
+	{1, "Create the dividend, correlation and price tables", func(db *Database) error {
+		// Databases created before schema_version existed already have
+		// these tables.
+		return db.execAll(
+			"CREATE TABLE IF NOT EXISTS dividend (ticker VARCHAR(10), date INTEGER, dividend REAL)",
+			"CREATE TABLE IF NOT EXISTS correlation (ticker1 VARCHAR(10), ticker2 VARCHAR(10), corr REAL, lastUpdateDate INTEGER)",
+			"CREATE INDEX IF NOT EXISTS correlation_index ON correlation (ticker1, ticker2)",
+			"CREATE TABLE IF NOT EXISTS price (ticker VARCHAR(10), date INTEGER, open REAL, high REAL, low REAL, close REAL, volume INTEGER, adjclose REAL)",
+			"CREATE INDEX IF NOT EXISTS price_index ON price (ticker, date)")
+	}},
+	{2, "Remove duplicate prices and make (ticker, date) unique", func(db *Database) error {
+		// Keep the row inserted last for each ticker and date.
+		return db.execAll(
+			"DELETE FROM price WHERE rowid NOT IN (SELECT MAX(rowid) FROM price GROUP BY ticker, date)",
+			"DROP INDEX IF EXISTS price_index",
+			"CREATE UNIQUE INDEX price_index ON price (ticker, date)")
+	}},
+	{3, "Key correlations by date range, sampling interval and missing data policy", func(db *Database) error {
+		// Nothing wrote to the table before this version.
+		return db.execAll(
+			"DELETE FROM correlation",
+			"ALTER TABLE correlation ADD COLUMN startDate INTEGER",
+			"ALTER TABLE correlation ADD COLUMN endDate INTEGER",
+			"ALTER TABLE correlation ADD COLUMN samplingInterval INTEGER",
+			"ALTER TABLE correlation ADD COLUMN missingData INTEGER",
+			"DROP INDEX IF EXISTS correlation_index",
+			"CREATE UNIQUE INDEX correlation_index ON correlation (ticker1, ticker2, startDate, endDate, samplingInterval, missingData)")
+	}},
+	{4, "Discard correlations computed without subtracting the mean returns", func(db *Database) error {
+		return db.Exec("DELETE FROM correlation")
+	}},
+	{5, "Key correlations by return type", func(db *Database) error {
+		// Existing rows are of simple returns.
+		return db.execAll(
+			"ALTER TABLE correlation ADD COLUMN returnType INTEGER NOT NULL DEFAULT 0",
+			"DROP INDEX IF EXISTS correlation_index",
+			"CREATE UNIQUE INDEX correlation_index ON correlation (ticker1, ticker2, startDate, endDate, samplingInterval, missingData, returnType)")
+	}},
+	{6, "Create the riskfree table", func(db *Database) error {
+		return db.Exec("CREATE TABLE riskfree (date INTEGER PRIMARY KEY, rate REAL)")
+	}},
+}
+
+// Run SQL statements that take no arguments, stopping at the first error.
+func (db Database) execAll(sqls... string) (error) {
+	for _, sql := range sqls {
+		if err := db.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The schema version the code expects.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations) - 1].Version
+}
+
+// The version of the last migration applied to the database, or 0 for a
+// database that predates schema_version.
+func (db Database) SchemaVersion() (int, error) {
+	exists, err := db.TableExists("schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+	rows, err := db.Query("SELECT MAX(version) FROM schema_version")
+	if err != nil || rows[0][0] == nil {
+		return 0, err
+	}
+	return int(rows[0][0].(int64)), nil
+}
+
+// Migrations not yet applied to the database, in the order they will run.
+func (db Database) PendingMigrations() ([]Migration, error) {
+	version, err := db.SchemaVersion()
+	if err != nil { return nil, err }
+	pending := []Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Apply pending migrations, each in its own transaction.
+func (db *Database) migrate() (error) {
+	err := db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, description TEXT, appliedDate INTEGER)")
+	if err != nil { return err }
+	pending, err := db.PendingMigrations()
+	if err != nil { return err }
+	for _, m := range pending {
+		log.Print("Migrating ", db.Path, " to schema version ", m.Version, ": ", m.Description)
+		err := db.inTransaction(func() error {
+			if err := m.apply(db); err != nil {
+				return err
+			}
+			return db.Exec("INSERT INTO schema_version VALUES(?, ?, ?)",
+				m.Version, m.Description, time.Now().Unix())
+		})
+		if err != nil {
+			return fmt.Errorf("Migration %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// Report the schema version of the database at path and the migrations
+// that CreateDb would apply to it, without changing the database.
+func SchemaStatus(path string) (version int, pending []Migration, err error) {
+	sqlite3.Initialize()
+	conn, err := sqlite3.Open(path, sqlite3.O_READONLY)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close()
+	db := Database{Path: path, db: conn}
+	version, err = db.SchemaVersion()
+	if err != nil { return 0, nil, err }
+	pending, err = db.PendingMigrations()
+	return version, pending, err
+}
@@ -0,0 +1,185 @@
+package portopt
+
+import "fmt"
+import "math"
+
+// How CovarianceMatrix estimates the covariance of returns. The shrinkage
+// estimators replace the sample covariance S with
+// δF + (1-δ)S for a structured target F, choosing the intensity δ in
+// [0, 1] that minimizes the expected squared error (Ledoit and Wolf).
+// They help when there are many securities and few samples.
+type CovarianceEstimator int
+
+const (
+	// The sample covariance, unmodified.
+	SampleCovariance CovarianceEstimator = iota
+
+	// Shrink toward a multiple of the identity matrix whose trace equals
+	// that of S ("A well-conditioned estimator for large-dimensional
+	// covariance matrices", 2004).
+	LedoitWolf
+
+	// Shrink toward the matrix in which every pair has the average sample
+	// correlation, keeping the sample variances ("Honey, I shrunk the
+	// sample covariance matrix", 2003).
+	ConstantCorrelation
+
+	// Shrink toward the diagonal of S, i.e., the sample variances with no
+	// correlation.
+	DiagonalTarget
+
+	// The exponentially weighted covariance, without shrinkage. See
+	// SetEwmaHalfLife.
+	EwmaCovariance
+)
+
+func (e CovarianceEstimator) String() string {
+	switch e {
+	case SampleCovariance: return "sample"
+	case LedoitWolf: return "ledoit-wolf"
+	case ConstantCorrelation: return "constant-correlation"
+	case DiagonalTarget: return "diagonal"
+	case EwmaCovariance: return "ewma"
+	}
+	return fmt.Sprintf("CovarianceEstimator(%d)", int(e))
+}
+
+// Set how CovarianceMatrix, CorrelationMatrix and Portfolio.Stats estimate
+// covariances. The default is SampleCovariance. Correlation always reports
+// the sample correlation.
+func (db *Database) SetCovarianceEstimator(e CovarianceEstimator) {
+	db.covariance = e
+	db.matrixCache.Clear()
+}
+
+func (db *Database) CovarianceEstimator() CovarianceEstimator { return db.covariance }
+
+// Apply the shrinkage estimator to the sample covariance of returns, where
+// returns[i][t] is the return of the i'th security in period t. returns
+// must hold only real returns, not the zero that statsAccumulator reports
+// for the first period. Returns the estimate and the shrinkage intensity
+// used.
+func shrinkCovariance(e CovarianceEstimator, returns [][]float64, sample *Matrix) (*Matrix, float64) {
+	n := sample.N()
+	if e == SampleCovariance || e == EwmaCovariance || n == 0 || len(returns[0]) < 2 {
+		return sample, 0
+	}
+	periods := len(returns[0])
+	t := float64(periods)
+
+	// Deviations from the mean return.
+	means := make([]float64, n)
+	dev := make([][]float64, n)
+	for i := range returns {
+		for _, r := range returns[i] {
+			means[i] += r
+		}
+		means[i] /= t
+		dev[i] = make([]float64, periods)
+		for k, r := range returns[i] {
+			dev[i][k] = r - means[i]
+		}
+	}
+
+	// The covariance of the returns themselves, which the asymptotic
+	// variances below are centered on.
+	s := newMatrix(sample.tickers)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			total := 0.0
+			for k := 0; k < periods; k++ {
+				total += dev[i][k] * dev[j][k]
+			}
+			s.set(i, j, total / t)
+			s.set(j, i, total / t)
+		}
+	}
+
+	// pi[i][j] is the asymptotic variance of sqrt(T) * S[i][j].
+	pi := newMatrix(sample.tickers)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			total := 0.0
+			for k := 0; k < periods; k++ {
+				d := dev[i][k] * dev[j][k] - s.At(i, j)
+				total += d * d
+			}
+			pi.set(i, j, total / t)
+			pi.set(j, i, total / t)
+		}
+	}
+
+	target := newMatrix(sample.tickers)
+	rho := 0.0  // the part of pi that the target shares with S
+	switch e {
+	case LedoitWolf:
+		mu := 0.0
+		for i := 0; i < n; i++ {
+			mu += sample.At(i, i)
+		}
+		mu /= float64(n)
+		for i := 0; i < n; i++ {
+			target.set(i, i, mu)
+		}
+	case DiagonalTarget:
+		for i := 0; i < n; i++ {
+			target.set(i, i, sample.At(i, i))
+			rho += pi.At(i, i)
+		}
+	case ConstantCorrelation:
+		sd := make([]float64, n)
+		for i := range sd {
+			sd[i] = math.Sqrt(sample.At(i, i))
+		}
+		avgCorr := 0.0
+		if n > 1 {
+			for i := 0; i < n; i++ {
+				for j := 0; j < i; j++ {
+					avgCorr += sample.At(i, j) / sd[i] / sd[j]
+				}
+			}
+			avgCorr /= float64(n * (n - 1) / 2)
+		}
+		for i := 0; i < n; i++ {
+			target.set(i, i, sample.At(i, i))
+			rho += pi.At(i, i)
+			for j := 0; j < n; j++ {
+				if i == j { continue }
+				target.set(i, j, avgCorr * (sd[i] * sd[j]))
+				// Asymptotic covariances of S[i][i] and S[j][j]
+				// with S[i][j].
+				thetaII, thetaJJ := 0.0, 0.0
+				for k := 0; k < periods; k++ {
+					dij := dev[i][k] * dev[j][k] - s.At(i, j)
+					thetaII += (dev[i][k] * dev[i][k] - s.At(i, i)) * dij
+					thetaJJ += (dev[j][k] * dev[j][k] - s.At(j, j)) * dij
+				}
+				rho += avgCorr / 2 * (sd[j] / sd[i] * thetaII / t + sd[i] / sd[j] * thetaJJ / t)
+			}
+		}
+	default:
+		doAssert(false, "Unknown covariance estimator ", e)
+	}
+
+	piTotal, gamma := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			piTotal += pi.At(i, j)
+			d := target.At(i, j) - sample.At(i, j)
+			gamma += d * d
+		}
+	}
+	if gamma == 0 {
+		// S already equals the target.
+		return sample, 0
+	}
+	delta := math.Max(0, math.Min(1, (piTotal - rho) / gamma / t))
+
+	estimate := newMatrix(sample.tickers)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			estimate.set(i, j, delta * target.At(i, j) + (1 - delta) * sample.At(i, j))
+		}
+	}
+	return estimate, delta
+}
@@ -0,0 +1,96 @@
+package portopt
+
+import "math"
+import "math/rand"
+import "testing"
+
+// Sample covariance of returns, as jointStats computes it.
+func sampleCovariance(tickers []string, returns [][]float64) *Matrix {
+	m := newMatrix(tickers)
+	t := float64(len(returns[0]))
+	for i := range returns {
+		for j := 0; j <= i; j++ {
+			mi, mj, total := 0.0, 0.0, 0.0
+			for k := range returns[i] {
+				mi += returns[i][k]
+				mj += returns[j][k]
+				total += returns[i][k] * returns[j][k]
+			}
+			m.set(i, j, total / t - mi / t * mj / t)
+			m.set(j, i, m.At(i, j))
+		}
+	}
+	return m
+}
+
+func TestShrinkCovariance(t *testing.T) {
+	// Three correlated series with few samples.
+	rng := rand.New(rand.NewSource(1))
+	tickers := []string{"A", "B", "C"}
+	returns := make([][]float64, 3)
+	for k := 0; k < 12; k++ {
+		common := rng.NormFloat64() * 0.03
+		for i := range returns {
+			returns[i] = append(returns[i], 0.01 + common * float64(i + 1) + rng.NormFloat64() * 0.02)
+		}
+	}
+	sample := sampleCovariance(tickers, returns)
+
+	if m, delta := shrinkCovariance(SampleCovariance, returns, sample); m != sample || delta != 0 {
+		t.Error(m, delta)
+	}
+	for _, e := range []CovarianceEstimator{LedoitWolf, ConstantCorrelation, DiagonalTarget} {
+		m, delta := shrinkCovariance(e, returns, sample)
+		if delta <= 0 || delta > 1 { t.Error(e, delta) }
+		trace, sampleTrace := 0.0, 0.0
+		for i := 0; i < 3; i++ {
+			trace += m.At(i, i)
+			sampleTrace += sample.At(i, i)
+			if e != LedoitWolf && m.At(i, i) != sample.At(i, i) { t.Error(e, i, m.At(i, i)) }
+			for j := 0; j < 3; j++ {
+				if m.At(i, j) != m.At(j, i) { t.Error(e, i, j) }
+			}
+		}
+		if math.Abs(trace - sampleTrace) > 1e-12 { t.Error(e, trace, sampleTrace) }
+		if e == DiagonalTarget {
+			want := (1 - delta) * sample.At(0, 1)
+			if math.Abs(m.At(0, 1) - want) > 1e-12 { t.Error(m.At(0, 1), want) }
+		}
+	}
+
+	// With two securities, the constant-correlation target is S itself,
+	// up to rounding.
+	two := newMatrix(tickers[:2])
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			two.set(i, j, sample.At(i, j))
+		}
+	}
+	m, _ := shrinkCovariance(ConstantCorrelation, returns[:2], two)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			if math.Abs(m.At(i, j) - two.At(i, j)) > 1e-15 { t.Error(m, two) }
+		}
+	}
+}
+
+func TestCovarianceEstimator(t *testing.T) {
+	db := newDb(t)
+	_, err := db.FillFromCsv("C.bak", "C")
+	if err != nil { t.Fatal(err) }
+	_, err = db.FillFromCsv("C.bak", "D")
+	if err != nil { t.Fatal(err) }
+
+	tickers := []string{"C", "D"}
+	sample, err := db.CovarianceMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	db.SetCovarianceEstimator(DiagonalTarget)
+	if db.CovarianceEstimator() != DiagonalTarget { t.Error(db.CovarianceEstimator()) }
+	shrunk, err := db.CovarianceMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	if shrunk.At(0, 0) != sample.At(0, 0) { t.Error(shrunk, sample) }
+	if shrunk.At(0, 1) >= sample.At(0, 1) { t.Error(shrunk, sample) }
+	corr, err := db.CorrelationMatrix(tickers, allTime)
+	if err != nil { t.Fatal(err) }
+	if corr.At(0, 1) >= 1 || math.Abs(corr.At(0, 0) - 1) > 1e-12 { t.Error(corr) }
+}
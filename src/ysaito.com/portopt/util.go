@@ -13,9 +13,13 @@ type statsAccumulator struct {
 	label string
 	frozen bool     // true once any stats accessor is called
 	data []float64  // list of adjusted price quotes
-	perPeriodReturn float64
-	arithmeticMean float64
+	returnType ReturnType
+
+	perPeriodReturn float64  // mean of the returns of type returnType
+	arithmeticMean float64  // mean of the simple returns
 	stddev float64
+	totalReturn float64
+	geometricMean float64
 }
 
 func newStatsAccumulator(label string) *statsAccumulator {
@@ -42,45 +46,113 @@ func (s *statsAccumulator) freeze() {
 	}
 	s.frozen = true
 
-	n := float64(len(s.data))
+	if len(s.data) < 2 {
+		return
+	}
+	// Number of returns; the first price has none.
+	n := float64(len(s.data) - 1)
 
 	lastValue := -1.0
 	total := 0.0
 	total2 := 0.0
+	simpleTotal := 0.0
 	for i, value := range s.data {
 		if i > 0 {
-			delta := (value - lastValue) / lastValue
+			delta := s.returnType.delta(value, lastValue)
 			total += delta
 			total2 += delta * delta
+			simpleTotal += SimpleReturns.delta(value, lastValue)
 		}
 		lastValue = value
 	}
 	s.perPeriodReturn = total / n
-	s.stddev = math.Sqrt(total2 / n - s.perPeriodReturn * s.perPeriodReturn)
+	s.arithmeticMean = simpleTotal / n
+	s.stddev = math.Sqrt(math.Max(0, total2 / n - s.perPeriodReturn * s.perPeriodReturn))
+	growth := s.data[len(s.data) - 1] / s.data[0]
+	s.totalReturn = growth - 1
+	s.geometricMean = math.Pow(growth, 1 / n) - 1
 }
 
 func (s *statsAccumulator) NumItems() int {
 	return len(s.data)
 }
 
+// The return of period i, from price i-1 to price i, for i >= 1. The
+// first price starts the first period and has no return.
 func (s *statsAccumulator) DeltaForPeriod(i int) float64 {
-	s.freeze()
-	if i == 0 {
-		return 0.0
+	doAssert(i > 0, s.label, ": no return for period ", i)
+	return s.returnType.delta(s.data[i], s.data[i - 1])
+}
+
+// Covariance of the per-period returns of two accumulators that were fed
+// aligned prices. It uses the same definitions as PerPeriodReturn and
+// StdDev, so covariance(s, s) == s.StdDev() * s.StdDev().
+func covariance(s1 *statsAccumulator, s2 *statsAccumulator) float64 {
+	doAssert(s1.NumItems() == s2.NumItems(), s1.label, " ", s2.label)
+	if s1.NumItems() < 2 {
+		return 0
 	}
-	value := s.data[i]
-	lastValue := s.data[i - 1]
-	return (value - lastValue) / lastValue
+	total := 0.0
+	for period := 1; period < s1.NumItems(); period++ {
+		total += s1.DeltaForPeriod(period) * s2.DeltaForPeriod(period)
+	}
+	return total / float64(s1.NumItems() - 1) - s1.PerPeriodReturn() * s2.PerPeriodReturn()
 }
 
+// Exponentially weighted covariance of the per-period returns of two
+// accumulators that were fed aligned prices, in the style of RiskMetrics:
+// the return k periods before the newest one has weight decay^k.
+// Deviations are taken from the weighted mean, so with decay == 1 this
+// equals covariance(s1, s2).
+func ewmaCovariance(s1 *statsAccumulator, s2 *statsAccumulator, decay float64) float64 {
+	doAssert(s1.NumItems() == s2.NumItems(), s1.label, " ", s2.label)
+	totalWeight, mean1, mean2, total := 0.0, 0.0, 0.0, 0.0
+	weight := 1.0
+	for period := s1.NumItems() - 1; period >= 1; period-- {
+		d1 := s1.DeltaForPeriod(period)
+		d2 := s2.DeltaForPeriod(period)
+		totalWeight += weight
+		mean1 += weight * d1
+		mean2 += weight * d2
+		total += weight * d1 * d2
+		weight *= decay
+	}
+	if totalWeight == 0 {
+		return 0
+	}
+	mean1 /= totalWeight
+	mean2 /= totalWeight
+	return total / totalWeight - mean1 * mean2
+}
+
+func (s *statsAccumulator) EwmaStdDev(decay float64) float64 {
+	return math.Sqrt(math.Max(0, ewmaCovariance(s, s, decay)))
+}
+
+// Mean of the returns of type returnType. Equals ArithmeticMean for
+// SimpleReturns.
 func (s *statsAccumulator) PerPeriodReturn() float64 {
 	s.freeze()
 	return s.perPeriodReturn
 }
 
+// Mean of the simple returns, regardless of returnType.
 func (s *statsAccumulator) ArithmeticMean() float64 {
 	s.freeze()
-	return s.perPeriodReturn
+	return s.arithmeticMean
+}
+
+// The compound return per period: the constant return that turns the
+// first price into the last one.
+func (s *statsAccumulator) GeometricMean() float64 {
+	s.freeze()
+	return s.geometricMean
+}
+
+// The last price over the first one, minus 1.
+func (s *statsAccumulator) TotalReturn() float64 {
+	s.freeze()
+	return s.totalReturn
 }
 
 func (s *statsAccumulator) StdDev() float64 {
@@ -5,6 +5,7 @@
 package portopt
 import "testing"
 import "log"
+import "math"
 func TestStat_Basic(t *testing.T) {
 	s := newStatsAccumulator("test")
 	s.Add(1.0)
@@ -14,3 +15,24 @@ func TestStat_Basic(t *testing.T) {
 	s.Add(16.0)
 	log.Print("S=", s.PerPeriodReturn(), s.StdDev())
 }
+
+func TestStat_Geometric(t *testing.T) {
+	s := newStatsAccumulator("test")
+	s.Add(100.0)
+	s.Add(200.0)
+	s.Add(100.0)
+	s.Add(121.0)
+	if math.Abs(s.ArithmeticMean() - (1.0 - 0.5 + 0.21) / 3) > 1e-12 { t.Error(s.ArithmeticMean()) }
+	if math.Abs(s.TotalReturn() - 0.21) > 1e-12 { t.Error(s.TotalReturn()) }
+	if math.Abs(s.GeometricMean() - (math.Pow(1.21, 1.0 / 3) - 1)) > 1e-12 { t.Error(s.GeometricMean()) }
+
+	l := newStatsAccumulator("log")
+	l.returnType = LogReturns
+	l.Add(100.0)
+	l.Add(200.0)
+	l.Add(100.0)
+	l.Add(121.0)
+	if math.Abs(l.PerPeriodReturn() - math.Log(1.21) / 3) > 1e-12 { t.Error(l.PerPeriodReturn()) }
+	if l.ArithmeticMean() != s.ArithmeticMean() { t.Error(l.ArithmeticMean()) }
+	if l.DeltaForPeriod(2) != -math.Log(2) { t.Error(l.DeltaForPeriod(2)) }
+}
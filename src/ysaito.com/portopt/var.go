@@ -0,0 +1,125 @@
+package portopt
+
+import "fmt"
+import "math"
+import "sort"
+
+var defaultVaRConfidenceLevels = []float64{0.95, 0.99}
+
+// Confidence levels of ValueAtRisk reported by default.
+func DefaultVaRConfidenceLevels() []float64 {
+	return append([]float64{}, defaultVaRConfidenceLevels...)
+}
+
+// Value at Risk (VaR) and Conditional VaR (CVaR, or expected shortfall) of
+// the simple return over one sampling period. At confidence level c, VaR
+// is the loss that is exceeded with probability 1-c, and CVaR is the
+// average loss in those cases. Losses are positive fractions, e.g., 0.1
+// for a 10% loss.
+type ValueAtRisk struct {
+	Confidence float64
+
+	// From the empirical distribution of the returns.
+	Historical float64
+	HistoricalCVaR float64
+
+	// Assuming normally distributed returns.
+	Gaussian float64
+	GaussianCVaR float64
+
+	// The Gaussian quantile corrected for the skewness and excess
+	// kurtosis of the returns (Cornish-Fisher expansion).
+	CornishFisher float64
+	CornishFisherCVaR float64
+}
+
+// Set the confidence levels, each in (0, 1), at which Stats and
+// Portfolio.Stats report ValueAtRisk. The default is
+// DefaultVaRConfidenceLevels. On error, the levels are left unchanged.
+func (db *Database) SetVaRConfidenceLevels(levels... float64) error {
+	for _, c := range levels {
+		if !(c > 0 && c < 1) {
+			return fmt.Errorf("Bad VaR confidence level %v, want one in (0, 1)", c)
+		}
+	}
+	db.varLevels = append([]float64{}, levels...)
+	db.statsCache.Clear()
+	return nil
+}
+
+func (db *Database) VaRConfidenceLevels() []float64 {
+	return append([]float64{}, db.varLevels...)
+}
+
+// The simple returns between consecutive values.
+func periodReturns(values []float64) []float64 {
+	if len(values) < 2 {
+		return []float64{}
+	}
+	returns := make([]float64, len(values) - 1)
+	for k := range returns {
+		returns[k] = SimpleReturns.delta(values[k + 1], values[k])
+	}
+	return returns
+}
+
+// The standard normal quantile function.
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2 * p - 1)
+}
+
+func normalDensity(z float64) float64 {
+	return math.Exp(-z * z / 2) / math.Sqrt(2 * math.Pi)
+}
+
+// The Cornish-Fisher approximation of the p-quantile of a standardized
+// distribution with the given skewness and excess kurtosis.
+func cornishFisherQuantile(p float64, skewness float64, kurtosis float64) float64 {
+	z := normalQuantile(p)
+	return z + (z * z - 1) * skewness / 6 +
+		(z * z * z - 3 * z) * kurtosis / 24 -
+		(2 * z * z * z - 5 * z) * skewness * skewness / 36
+}
+
+// Number of points used to integrate the Cornish-Fisher quantile for CVaR.
+const cvarSteps = 1000
+
+// Compute ValueAtRisk at each confidence level from per-period returns.
+func valueAtRisk(returns []float64, levels []float64) []ValueAtRisk {
+	if len(returns) == 0 {
+		return nil
+	}
+	sorted := append([]float64{}, returns...)
+	sort.Float64s(sorted)
+	mean, stddev, skewness, kurtosis := moments(returns)
+
+	result := make([]ValueAtRisk, len(levels))
+	for i, c := range levels {
+		v := &result[i]
+		v.Confidence = c
+		tail := 1 - c
+
+		// The worst k returns make up the tail.
+		k := int(math.Ceil(tail * float64(len(sorted)) - 1e-9))
+		if k < 1 { k = 1 }
+		v.Historical = -sorted[k - 1]
+		total := 0.0
+		for _, r := range sorted[:k] {
+			total += r
+		}
+		v.HistoricalCVaR = -total / float64(k)
+
+		z := normalQuantile(tail)
+		v.Gaussian = -(mean + z * stddev)
+		v.GaussianCVaR = -(mean - stddev * normalDensity(z) / tail)
+
+		v.CornishFisher = -(mean + cornishFisherQuantile(tail, skewness, kurtosis) * stddev)
+		total = 0.0
+		for step := 0; step < cvarSteps; step++ {
+			p := tail * (float64(step) + 0.5) / cvarSteps
+			total += cornishFisherQuantile(p, skewness, kurtosis)
+		}
+		v.CornishFisherCVaR = -(mean + total / cvarSteps * stddev)
+	}
+	return result
+}
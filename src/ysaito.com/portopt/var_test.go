@@ -0,0 +1,63 @@
+package portopt
+
+import "math"
+import "testing"
+
+func TestValueAtRisk(t *testing.T) {
+	if math.Abs(normalQuantile(0.05) + 1.644854) > 1e-6 { t.Error(normalQuantile(0.05)) }
+	if cornishFisherQuantile(0.05, 0, 0) != normalQuantile(0.05) { t.Error(cornishFisherQuantile(0.05, 0, 0)) }
+	// Negative skew fattens the left tail.
+	if cornishFisherQuantile(0.01, -1, 0) >= normalQuantile(0.01) { t.Error(cornishFisherQuantile(0.01, -1, 0)) }
+
+	// -0.10, -0.09, ..., 0.89
+	returns := make([]float64, 100)
+	for i := range returns {
+		returns[(i * 37) % 100] = float64(i - 10) / 100
+	}
+	vars := valueAtRisk(returns, []float64{0.95, 0.99})
+	if len(vars) != 2 || vars[0].Confidence != 0.95 || vars[1].Confidence != 0.99 { t.Fatal(vars) }
+	if math.Abs(vars[0].Historical - 0.06) > 1e-12 { t.Error(vars[0]) }
+	if math.Abs(vars[0].HistoricalCVaR - 0.08) > 1e-12 { t.Error(vars[0]) }
+	if math.Abs(vars[1].Historical - 0.1) > 1e-12 || vars[1].HistoricalCVaR != vars[1].Historical { t.Error(vars[1]) }
+
+	mean, stddev, _, _ := moments(returns)
+	if math.Abs(vars[0].Gaussian - (1.644854 * stddev - mean)) > 1e-6 { t.Error(vars[0], mean, stddev) }
+	for _, v := range vars {
+		if v.GaussianCVaR <= v.Gaussian || v.CornishFisherCVaR <= v.CornishFisher { t.Error(v) }
+	}
+	if vars[1].Gaussian <= vars[0].Gaussian { t.Error(vars) }
+}
+
+func TestMoments(t *testing.T) {
+	mean, stddev, skewness, kurtosis := moments([]float64{1, 2, 3, 4})
+	if mean != 2.5 || math.Abs(stddev - math.Sqrt(1.25)) > 1e-12 || skewness != 0 { t.Error(mean, stddev, skewness) }
+	if math.Abs(kurtosis - (-1.36)) > 1e-12 { t.Error(kurtosis) }
+}
+
+func TestStats_VaR(t *testing.T) {
+	// Returns of -0.05, -0.04, ..., 0.14 in a scrambled order, with mean
+	// 0.045 and standard deviation 0.01 * sqrt((20 * 20 - 1) / 12).
+	returns := make([]float64, 20)
+	for i := range returns {
+		returns[(i * 7) % 20] = float64(i - 5) / 100
+	}
+	f := newStatsFixture(t, "A", map[string][]float64{"A": compound(returns...)})
+	stats := f.stats
+	if len(stats.VaR) != 2 || stats.VaR[0].Confidence != 0.95 || stats.VaR[1].Confidence != 0.99 { t.Fatal(stats.VaR) }
+	// The worst return is the whole 5% tail.
+	if math.Abs(stats.VaR[0].Historical - 0.05) > 1e-12 || math.Abs(stats.VaR[0].HistoricalCVaR - 0.05) > 1e-12 { t.Error(stats.VaR[0]) }
+	sd := 0.01 * math.Sqrt(399.0 / 12)
+	if math.Abs(stats.VaR[0].Gaussian - (1.644854 * sd - 0.045)) > 1e-6 { t.Error(stats.VaR[0], sd) }
+	if math.Abs(f.pstats.VaR[0].Gaussian - stats.VaR[0].Gaussian) > 1e-12 { t.Error(f.pstats.VaR, stats.VaR) }
+
+	db := f.db
+	if err := db.SetVaRConfidenceLevels(0.9, 1); err == nil { t.Error("Accepted confidence level 1") }
+	if levels := db.VaRConfidenceLevels(); len(levels) != 2 { t.Error(levels) }
+	if err := db.SetVaRConfidenceLevels(0.9); err != nil { t.Fatal(err) }
+	db.VaRConfidenceLevels()[0] = 0.5
+	stats, err := db.Stats("A", allTime)
+	if err != nil { t.Fatal(err) }
+	// The two worst returns make up the 10% tail.
+	if len(stats.VaR) != 1 || stats.VaR[0].Confidence != 0.9 { t.Fatal(stats.VaR) }
+	if math.Abs(stats.VaR[0].Historical - 0.04) > 1e-12 || math.Abs(stats.VaR[0].HistoricalCVaR - 0.045) > 1e-12 { t.Error(stats.VaR) }
+}